@@ -16,8 +16,15 @@
 package chat
 
 const (
-	_ = "POST"
-	_ = "https://api.openai.com/v1/chat/completions"
+	Method = "POST"
+	Path   = "/chat/completions"
+)
+
+// Roles of the author of a message.
+const (
+	RoleSystem    = "system"
+	RoleUser      = "user"
+	RoleAssistant = "assistant"
 )
 
 type Request struct {
@@ -28,11 +35,61 @@ type Request struct {
 	Messages []Message `json:"messages"`
 
 	// The maximum number of tokens to generate in the completion.
-	// Defaults to 16.
-	MaxTokens int `json:"max_tokens"`
+	// Defaults to the most the model can generate.
+	MaxTokens int `json:"max_tokens,omitempty"`
 
 	// What sampling temperature to use, between 0 and 2.
 	Temperature float64 `json:"temperature"`
+
+	// Nucleus sampling: only the tokens comprising the top TopP
+	// probability mass are considered.
+	TopP float64 `json:"top_p,omitempty"`
+
+	// How many choices to generate for each prompt.
+	N int `json:"n,omitempty"`
+
+	// Up to 4 sequences where the API stops generating further tokens.
+	Stop []string `json:"stop,omitempty"`
+
+	// Between -2.0 and 2.0. Positive values penalize tokens that already
+	// appear in the text so far, increasing the likelihood of new topics.
+	PresencePenalty float64 `json:"presence_penalty,omitempty"`
+
+	// Between -2.0 and 2.0. Positive values penalize tokens based on
+	// their frequency in the text so far, decreasing repetition.
+	FrequencyPenalty float64 `json:"frequency_penalty,omitempty"`
+
+	// If set, repeated requests with the same seed and parameters
+	// should return the same result, on a best effort basis.
+	Seed int `json:"seed,omitempty"`
+
+	// Maps token IDs to a bias between -100 and 100 added to their
+	// likelihood of being generated.
+	LogitBias map[string]int `json:"logit_bias,omitempty"`
+
+	// A unique identifier of the end user, to help detect abuse.
+	User string `json:"user,omitempty"`
+
+	// The format the model must output.
+	ResponseFormat *ResponseFormat `json:"response_format,omitempty"`
+
+	// If set, partial message deltas are sent as server-sent events
+	// as they become available, followed by a data: [DONE] message.
+	Stream bool `json:"stream,omitempty"`
+
+	// Options for streamed responses, only set when Stream is.
+	StreamOptions *StreamOptions `json:"stream_options,omitempty"`
+}
+
+type ResponseFormat struct {
+	// One of text or json_object.
+	Type string `json:"type"`
+}
+
+type StreamOptions struct {
+	// If set, an additional chunk with no choices is sent before the
+	// data: [DONE] message, holding the usage for the whole request.
+	IncludeUsage bool `json:"include_usage"`
 }
 
 type Message struct {
@@ -58,6 +115,21 @@ type Choice struct {
 	FinishReason string  `json:"finish_reason"`
 }
 
+// Chunk is a piece of a chat completion sent when streaming.
+type Chunk struct {
+	ID      string        `json:"id"`
+	Object  string        `json:"object"`
+	Created int           `json:"created"`
+	Choices []ChunkChoice `json:"choices"`
+	Usage   *Usage        `json:"usage,omitempty"` // Only set in the last chunk.
+}
+
+type ChunkChoice struct {
+	Index        int     `json:"index"`
+	Delta        Message `json:"delta"`
+	FinishReason string  `json:"finish_reason"`
+}
+
 type Usage struct {
 	PromptTokens     int `json:"prompt_tokens"`
 	CompletionTokens int `json:"completion_tokens"`
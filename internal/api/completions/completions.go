@@ -16,8 +16,8 @@
 package completions
 
 const (
-	_ = "POST"
-	_ = "https://api.openai.com/v1/completions"
+	Method = "POST"
+	Path   = "/completions"
 )
 
 type Request struct {
@@ -29,10 +29,53 @@ type Request struct {
 
 	// The maximum number of tokens to generate in the completion.
 	// Defaults to 16.
-	MaxTokens int `json:"max_tokens"`
+	MaxTokens int `json:"max_tokens,omitempty"`
 
 	// What sampling temperature to use, between 0 and 2.
 	Temperature float64 `json:"temperature"`
+
+	// Nucleus sampling: only the tokens comprising the top TopP
+	// probability mass are considered.
+	TopP float64 `json:"top_p,omitempty"`
+
+	// How many completions to generate for each prompt.
+	N int `json:"n,omitempty"`
+
+	// Up to 4 sequences where the API stops generating further tokens.
+	Stop []string `json:"stop,omitempty"`
+
+	// Between -2.0 and 2.0. Positive values penalize tokens that already
+	// appear in the text so far, increasing the likelihood of new topics.
+	PresencePenalty float64 `json:"presence_penalty,omitempty"`
+
+	// Between -2.0 and 2.0. Positive values penalize tokens based on
+	// their frequency in the text so far, decreasing repetition.
+	FrequencyPenalty float64 `json:"frequency_penalty,omitempty"`
+
+	// If set, repeated requests with the same seed and parameters
+	// should return the same result, on a best effort basis.
+	Seed int `json:"seed,omitempty"`
+
+	// Maps token IDs to a bias between -100 and 100 added to their
+	// likelihood of being generated.
+	LogitBias map[string]int `json:"logit_bias,omitempty"`
+
+	// A unique identifier of the end user, to help detect abuse.
+	User string `json:"user,omitempty"`
+
+	// If set, partial progress is sent as server-sent events as it
+	// becomes available, followed by a data: [DONE] message. Each
+	// event holds a Response with the text generated since the last one.
+	Stream bool `json:"stream,omitempty"`
+
+	// Options for streamed responses, only set when Stream is.
+	StreamOptions *StreamOptions `json:"stream_options,omitempty"`
+}
+
+type StreamOptions struct {
+	// If set, an additional event with no choices is sent before the
+	// data: [DONE] message, holding the usage for the whole request.
+	IncludeUsage bool `json:"include_usage"`
 }
 
 type Response struct {
@@ -43,6 +86,7 @@ type Response struct {
 	Choices      []Choice     `json:"choices"`
 	Completion   Completion   `json:"completion"`
 	Conversation Conversation `json:"conversation"`
+	Usage        Usage        `json:"usage"`
 }
 
 type Completion struct {
@@ -54,9 +98,10 @@ type Completion struct {
 }
 
 type Choice struct {
-	Text    string  `json:"text"`
-	Index   int     `json:"index"`
-	LogProb float64 `json:"logproba"`
+	Text         string  `json:"text"`
+	Index        int     `json:"index"`
+	LogProb      float64 `json:"logproba"`
+	FinishReason string  `json:"finish_reason"`
 }
 
 type Conversation struct {
@@ -73,3 +118,9 @@ type Message struct {
 	Author    string `json:"author"`
 	Body      string `json:"body"`
 }
+
+type Usage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+	TotalTokens      int `json:"total_tokens"`
+}
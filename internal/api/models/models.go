@@ -15,17 +15,37 @@
 // Package models implements the Models OpenAI endpoint.
 package models
 
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
 const (
-	_ = "GET"
-	_ = "https://api.openai.com/v1/models"
+	Method = "GET"
+	Path   = "/models"
 )
 
-type Request struct{}
+// List is the response of the endpoint.
+type List struct {
+	Object string  `json:"object"`
+	Data   []Model `json:"data"`
+}
 
-type Call interface {
-	ParseTokens(input []string) ([]string, error)
+// Model describes a model that can be used with the API.
+type Model struct {
+	ID      string `json:"id"`
+	Object  string `json:"object"`
+	Created int64  `json:"created"`
+	OwnedBy string `json:"owned_by"`
 }
 
-func (r Request) ParseTokens(input []string) ([]string, error) {
-	return nil, nil
+// String describes m, one property per line.
+func (m Model) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "id:       %s\n", m.ID)
+	fmt.Fprintf(&b, "object:   %s\n", m.Object)
+	fmt.Fprintf(&b, "owned by: %s\n", m.OwnedBy)
+	fmt.Fprintf(&b, "created:  %s", time.Unix(m.Created, 0).UTC().Format(time.DateOnly))
+	return b.String()
 }
@@ -0,0 +1,97 @@
+// MIT License
+//
+// Copyright (c) 2023 Kevin Herro
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// Package sse decodes streams of server-sent events, the format used
+// by OpenAI endpoints to stream partial results.
+package sse
+
+import (
+	"bufio"
+	"io"
+	"strings"
+)
+
+// Done is the data of the event that OpenAI endpoints send
+// to mark the end of a stream.
+const Done = "[DONE]"
+
+// An Event is a single server-sent event.
+type Event struct {
+	Type string // Event type, "message" if unspecified.
+	ID   string // Last event ID.
+	Data string // Event data, with lines joined by \n.
+}
+
+// A Decoder reads and decodes events from an input stream.
+type Decoder struct {
+	r      *bufio.Reader
+	lastID string
+}
+
+// NewDecoder returns a new decoder that reads from r.
+func NewDecoder(r io.Reader) *Decoder {
+	return &Decoder{r: bufio.NewReader(r)}
+}
+
+// Next returns the next event in the stream. It returns io.EOF when the
+// stream ends cleanly between events, and io.ErrUnexpectedEOF when it
+// ends in the middle of an event.
+func (d *Decoder) Next() (*Event, error) {
+	var data []string
+	var typ string
+	started := false
+	for {
+		line, err := d.r.ReadString('\n')
+		if err != nil {
+			if err != io.EOF {
+				return nil, err
+			}
+			if started || line != "" {
+				return nil, io.ErrUnexpectedEOF
+			}
+			return nil, io.EOF
+		}
+		line = strings.TrimSuffix(strings.TrimSuffix(line, "\n"), "\r")
+
+		if line == "" {
+			// A blank line dispatches the event, if there is one.
+			if data == nil {
+				typ, started = "", false
+				continue
+			}
+			if typ == "" {
+				typ = "message"
+			}
+			return &Event{Type: typ, ID: d.lastID, Data: strings.Join(data, "\n")}, nil
+		}
+		started = true
+
+		field, value, _ := strings.Cut(line, ":")
+		value = strings.TrimPrefix(value, " ")
+		switch field {
+		case "":
+			// Comment, typically used as a keep-alive.
+		case "data":
+			data = append(data, value)
+		case "event":
+			typ = value
+		case "id":
+			if !strings.ContainsRune(value, 0) {
+				d.lastID = value
+			}
+		default:
+			// Unknown fields, including retry, are ignored.
+		}
+	}
+}
@@ -0,0 +1,438 @@
+// MIT License
+//
+// Copyright (c) 2023 Kevin Herro
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// Package apitest provides a fake of the OpenAI API, for hermetic tests
+// and offline demos. It serves the endpoints used by vyx with scripted
+// replies, errors and latency, and streams replies when asked to.
+package apitest
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kevherro/vyx/internal/api/chat"
+	"github.com/kevherro/vyx/internal/api/completions"
+	"github.com/kevherro/vyx/internal/api/models"
+)
+
+// Reply scripts the response of the server to a request.
+type Reply struct {
+	// Text of the reply. If empty, the reply echoes the prompt.
+	Text string
+
+	// Chunks holds the pieces the reply is streamed in. If nil, Text
+	// is streamed one word at a time.
+	Chunks []string
+
+	// FinishReason defaults to "stop".
+	FinishReason string
+
+	// Usage reported for the request.
+	Usage chat.Usage
+
+	// Status is the HTTP status code of the response. If it is not
+	// 200, the response holds an error with ErrorType, ErrorCode and
+	// Message instead of a reply.
+	Status    int
+	ErrorType string
+	ErrorCode string
+	Message   string
+
+	// StreamError, if set, is sent as an error event after the chunks
+	// of a streamed reply.
+	StreamError string
+
+	// Drop closes the connection after the chunks of a streamed reply,
+	// before the end of the stream.
+	Drop bool
+
+	// Header holds extra headers for the response.
+	Header http.Header
+
+	// Latency delays the response.
+	Latency time.Duration
+
+	// ChunkLatency delays every chunk of a streamed reply.
+	ChunkLatency time.Duration
+}
+
+// Request is a request received by the server.
+type Request struct {
+	Method string
+	Path   string
+	Header http.Header
+	Body   []byte
+}
+
+// Chat decodes the body of r as a chat request.
+func (r Request) Chat() (*chat.Request, error) {
+	var req chat.Request
+	err := json.Unmarshal(r.Body, &req)
+	return &req, err
+}
+
+// Server is a fake OpenAI API server.
+type Server struct {
+	// APIKey, if set, must be sent by clients as a bearer token.
+	APIKey string
+
+	// Models are listed by the models endpoint.
+	Models []models.Model
+
+	// Latency delays every response, in addition to that of replies.
+	Latency time.Duration
+
+	srv *httptest.Server
+
+	mu       sync.Mutex
+	replies  []Reply   // Scripted replies, in the order they are used.
+	requests []Request // Requests received so far.
+}
+
+// NewServer starts and returns a fake server.
+// The caller should call Close when finished, to shut it down.
+func NewServer() *Server {
+	s := &Server{
+		Models: []models.Model{
+			{ID: "gpt-4o", Object: "model", Created: 1715367049, OwnedBy: "system"},
+			{ID: "gpt-4o-mini", Object: "model", Created: 1721172741, OwnedBy: "system"},
+			{ID: "gpt-3.5-turbo-instruct", Object: "model", Created: 1692901427, OwnedBy: "system"},
+		},
+	}
+	s.srv = httptest.NewServer(s)
+	return s
+}
+
+// URL returns the base URL of the API served by s.
+func (s *Server) URL() string {
+	return s.srv.URL + "/v1"
+}
+
+// Client returns an HTTP client configured for requests to s.
+func (s *Server) Client() *http.Client {
+	return s.srv.Client()
+}
+
+// Close shuts down s.
+func (s *Server) Close() {
+	s.srv.Close()
+}
+
+// Push queues replies, to be used in order by the next requests that
+// produce replies or errors.
+func (s *Server) Push(replies ...Reply) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.replies = append(s.replies, replies...)
+}
+
+// Requests returns the requests received so far.
+func (s *Server) Requests() []Request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Request(nil), s.requests...)
+}
+
+// LastRequest returns the last request received, or false if none was.
+func (s *Server) LastRequest() (Request, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.requests) == 0 {
+		return Request{}, false
+	}
+	return s.requests[len(s.requests)-1], true
+}
+
+// next returns the next scripted reply, or a default one.
+func (s *Server) next() Reply {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.replies) == 0 {
+		return Reply{}
+	}
+	r := s.replies[0]
+	s.replies = s.replies[1:]
+	return r
+}
+
+// ServeHTTP implements http.Handler, so that the fake can also be
+// served by a regular HTTP server, e.g. for demos.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	s.mu.Lock()
+	s.requests = append(s.requests, Request{Method: r.Method, Path: r.URL.Path, Header: r.Header.Clone(), Body: body})
+	s.mu.Unlock()
+
+	time.Sleep(s.Latency)
+	w.Header().Set("X-Request-Id", fmt.Sprintf("req_%d", len(s.Requests())))
+
+	if s.APIKey != "" && r.Header.Get("Authorization") != "Bearer "+s.APIKey {
+		writeError(w, http.StatusUnauthorized, "invalid_request_error", "invalid_api_key", "Incorrect API key provided.")
+		return
+	}
+
+	path := strings.TrimPrefix(r.URL.Path, "/v1")
+	switch {
+	case r.Method == http.MethodPost && path == chat.Path:
+		s.serveChat(w, body)
+	case r.Method == http.MethodPost && path == completions.Path:
+		s.serveCompletions(w, body)
+	case r.Method == http.MethodGet && path == models.Path:
+		writeJSON(w, models.List{Object: "list", Data: s.Models})
+	case r.Method == http.MethodGet && strings.HasPrefix(path, models.Path+"/"):
+		id := strings.TrimPrefix(path, models.Path+"/")
+		for _, m := range s.Models {
+			if m.ID == id {
+				writeJSON(w, m)
+				return
+			}
+		}
+		writeError(w, http.StatusNotFound, "invalid_request_error", "model_not_found",
+			fmt.Sprintf("The model '%s' does not exist", id))
+	case r.Method == http.MethodPost && path == "/embeddings":
+		s.serveEmbeddings(w, body)
+	case r.Method == http.MethodPost && path == "/images/generations":
+		writeJSON(w, map[string]any{
+			"created": time.Now().Unix(),
+			"data":    []map[string]string{{"url": s.srv.URL + "/images/fake.png"}},
+		})
+	case r.Method == http.MethodGet && path == "/files":
+		writeJSON(w, map[string]any{"object": "list", "data": []any{}})
+	case r.Method == http.MethodPost && path == "/files":
+		writeJSON(w, map[string]any{
+			"id":         "file-fake",
+			"object":     "file",
+			"bytes":      len(body),
+			"created_at": time.Now().Unix(),
+			"filename":   "upload",
+			"purpose":    "fine-tune",
+		})
+	default:
+		writeError(w, http.StatusNotFound, "invalid_request_error", "unknown_url",
+			fmt.Sprintf("Unknown request URL: %s %s", r.Method, r.URL.Path))
+	}
+}
+
+// reply returns the next reply, after writing its error and returning
+// false if it is scripted to fail.
+func (s *Server) reply(w http.ResponseWriter, prompt string) (Reply, bool) {
+	rep := s.next()
+	time.Sleep(rep.Latency)
+	for k, v := range rep.Header {
+		w.Header()[k] = v
+	}
+	if rep.Status != 0 && rep.Status != http.StatusOK {
+		msg := rep.Message
+		if msg == "" {
+			msg = http.StatusText(rep.Status)
+		}
+		writeError(w, rep.Status, rep.ErrorType, rep.ErrorCode, msg)
+		return rep, false
+	}
+	if rep.Text == "" && rep.Chunks == nil {
+		rep.Text = "echo: " + prompt
+	}
+	if rep.Chunks == nil {
+		rep.Chunks = splitWords(rep.Text)
+	} else if rep.Text == "" {
+		rep.Text = strings.Join(rep.Chunks, "")
+	}
+	if rep.FinishReason == "" {
+		rep.FinishReason = "stop"
+	}
+	return rep, true
+}
+
+func (s *Server) serveChat(w http.ResponseWriter, body []byte) {
+	var req chat.Request
+	if err := json.Unmarshal(body, &req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_request_error", "", err.Error())
+		return
+	}
+	var prompt string
+	if n := len(req.Messages); n > 0 {
+		prompt = req.Messages[n-1].Content
+	}
+	rep, ok := s.reply(w, prompt)
+	if !ok {
+		return
+	}
+
+	if !req.Stream {
+		writeJSON(w, chat.Response{
+			ID:     "chatcmpl-fake",
+			Object: "chat.completion",
+			Choices: []chat.Choice{{
+				Message:      chat.Message{Role: chat.RoleAssistant, Content: rep.Text},
+				FinishReason: rep.FinishReason,
+			}},
+			Usage: rep.Usage,
+		})
+		return
+	}
+
+	includeUsage := req.StreamOptions != nil && req.StreamOptions.IncludeUsage
+	stream(w, rep, includeUsage, func(delta, finish string) any {
+		c := chat.Chunk{ID: "chatcmpl-fake", Object: "chat.completion.chunk"}
+		c.Choices = []chat.ChunkChoice{{Delta: chat.Message{Content: delta}, FinishReason: finish}}
+		return c
+	}, func() any {
+		u := rep.Usage
+		return chat.Chunk{ID: "chatcmpl-fake", Object: "chat.completion.chunk", Choices: []chat.ChunkChoice{}, Usage: &u}
+	})
+}
+
+func (s *Server) serveCompletions(w http.ResponseWriter, body []byte) {
+	var req completions.Request
+	if err := json.Unmarshal(body, &req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_request_error", "", err.Error())
+		return
+	}
+	rep, ok := s.reply(w, req.Prompt)
+	if !ok {
+		return
+	}
+
+	if !req.Stream {
+		writeJSON(w, completions.Response{
+			ID:      "cmpl-fake",
+			Object:  "text_completion",
+			Model:   req.Model,
+			Choices: []completions.Choice{{Text: rep.Text, FinishReason: rep.FinishReason}},
+			Usage:   completions.Usage(rep.Usage),
+		})
+		return
+	}
+
+	includeUsage := req.StreamOptions != nil && req.StreamOptions.IncludeUsage
+	stream(w, rep, includeUsage, func(delta, finish string) any {
+		return completions.Response{
+			ID:      "cmpl-fake",
+			Object:  "text_completion",
+			Model:   req.Model,
+			Choices: []completions.Choice{{Text: delta, FinishReason: finish}},
+		}
+	}, func() any {
+		return completions.Response{
+			ID:      "cmpl-fake",
+			Object:  "text_completion",
+			Model:   req.Model,
+			Choices: []completions.Choice{},
+			Usage:   completions.Usage(rep.Usage),
+		}
+	})
+}
+
+func (s *Server) serveEmbeddings(w http.ResponseWriter, body []byte) {
+	var req struct {
+		Model string `json:"model"`
+		Input any    `json:"input"`
+	}
+	if err := json.Unmarshal(body, &req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_request_error", "", err.Error())
+		return
+	}
+	var inputs []string
+	switch in := req.Input.(type) {
+	case string:
+		inputs = []string{in}
+	case []any:
+		for _, v := range in {
+			inputs = append(inputs, fmt.Sprint(v))
+		}
+	}
+	var data []map[string]any
+	for i, in := range inputs {
+		// A deterministic embedding derived from the input.
+		vec := make([]float64, 8)
+		for j, b := range []byte(in) {
+			vec[j%len(vec)] += float64(b) / 255
+		}
+		data = append(data, map[string]any{"object": "embedding", "index": i, "embedding": vec})
+	}
+	writeJSON(w, map[string]any{"object": "list", "model": req.Model, "data": data})
+}
+
+// stream writes rep as server-sent events, using chunk to make the
+// event for each piece of the reply and, if includeUsage is set, usage
+// to make the event reporting its usage.
+func stream(w http.ResponseWriter, rep Reply, includeUsage bool, chunk func(delta, finish string) any, usage func() any) {
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	flusher, _ := w.(http.Flusher)
+	event := func(v any) {
+		data, _ := json.Marshal(v)
+		fmt.Fprintf(w, "data: %s\n\n", data)
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}
+
+	for _, c := range rep.Chunks {
+		time.Sleep(rep.ChunkLatency)
+		event(chunk(c, ""))
+	}
+	if rep.Drop {
+		panic(http.ErrAbortHandler)
+	}
+	if rep.StreamError != "" {
+		event(map[string]any{"error": map[string]any{"message": rep.StreamError, "type": "server_error"}})
+		return
+	}
+	event(chunk("", rep.FinishReason))
+	if includeUsage {
+		event(usage())
+	}
+	fmt.Fprint(w, "data: [DONE]\n\n")
+}
+
+// splitWords splits text in words, each with the spaces that follow it.
+func splitWords(text string) []string {
+	var words []string
+	for text != "" {
+		i := strings.IndexAny(text, " \n")
+		if i == -1 {
+			words = append(words, text)
+			break
+		}
+		j := i
+		for j < len(text) && (text[j] == ' ' || text[j] == '\n') {
+			j++
+		}
+		words = append(words, text[:j])
+		text = text[j:]
+	}
+	return words
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, typ, code, msg string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	e := map[string]any{"message": msg, "type": typ, "param": nil, "code": nil}
+	if code != "" {
+		e["code"] = code
+	}
+	json.NewEncoder(w).Encode(map[string]any{"error": e})
+}
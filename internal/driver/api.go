@@ -1,67 +1,337 @@
+// MIT License
+//
+// Copyright (c) 2023 Kevin Herro
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
 package driver
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"os"
-	"strings"
+	"time"
 
+	"github.com/kevherro/vyx/internal/api/chat"
 	"github.com/kevherro/vyx/internal/api/completions"
+	"github.com/kevherro/vyx/internal/plugin"
 )
 
-const (
-	url   = "www.openai.com"
-	model = "model"
-)
+// apiReply is a reply from the chat or completions endpoint.
+type apiReply struct {
+	// Text of the reply, exactly as generated, formatting included.
+	Text string
+
+	// The reason generation stopped: stop, length or content_filter.
+	FinishReason string
 
-func parseTokens(input []string) ([]string, error) {
-	prompt := strings.Join(input, " ")
+	// Tokens used by the request, if reported.
+	Usage chat.Usage
+}
+
+// ask sends prompt to the configured endpoint and shows the reply on the
+// UI, as it arrives if streaming is enabled. When the chat endpoint is used,
+// the prompt is sent along with the conversation so far, and the prompt
+// and reply are appended to conv.
+func ask(ctx context.Context, o *plugin.Options, conv *conversation, prompt string) (*apiReply, error) {
 	cfg := currentConfig()
-	payload := &completions.Request{
-		Prompt:      prompt,
-		Model:       model,
-		MaxTokens:   cfg.MaxTokens,
-		Temperature: cfg.Temperature,
+
+	var reply *apiReply
+	var err error
+	switch cfg.Endpoint {
+	case "chat":
+		reply, err = chatCompletion(ctx, o, cfg, conv, prompt)
+	default:
+		reply, err = completion(ctx, o, cfg, prompt)
+	}
+	if err != nil {
+		return nil, err
+	}
+	switch reply.FinishReason {
+	case "length":
+		o.UI.PrintErr("reply truncated: max_tokens reached")
+	case finishInterrupted:
+		o.UI.PrintErr("reply interrupted")
 	}
+	return reply, nil
+}
 
-	jsonData, err := json.Marshal(payload)
+// chatCompletion sends the conversation in conv followed by prompt to
+// the chat endpoint and shows the reply on the UI. The conversation is
+// preceded by the system message configured in cfg, if any.
+func chatCompletion(ctx context.Context, o *plugin.Options, cfg config, conv *conversation, prompt string) (*apiReply, error) {
+	system, err := systemMessage(cfg)
 	if err != nil {
 		return nil, err
 	}
+	s, err := samplingOf(cfg)
+	if err != nil {
+		return nil, err
+	}
+	messages := conv.with(prompt)
+	if system != "" {
+		messages = append([]chat.Message{{Role: chat.RoleSystem, Content: system}}, messages...)
+	}
+	payload := &chat.Request{
+		Model:            cfg.Model,
+		Messages:         messages,
+		MaxTokens:        cfg.MaxTokens,
+		Temperature:      cfg.Temperature,
+		TopP:             cfg.TopP,
+		N:                cfg.N,
+		Stop:             s.stop,
+		PresencePenalty:  cfg.PresencePenalty,
+		FrequencyPenalty: cfg.FrequencyPenalty,
+		Seed:             cfg.Seed,
+		LogitBias:        s.logitBias,
+		User:             cfg.User,
+		Stream:           streams(cfg),
+	}
+	if cfg.ResponseFormat != "text" {
+		payload.ResponseFormat = &chat.ResponseFormat{Type: cfg.ResponseFormat}
+	}
+	if payload.Stream {
+		payload.StreamOptions = &chat.StreamOptions{IncludeUsage: true}
+	}
 
-	req, err := http.NewRequest("POST", url, bytes.NewBuffer(jsonData))
+	var reply *apiReply
+	if payload.Stream {
+		reply, err = streamChat(ctx, o, payload)
+	} else {
+		var chatResponse chat.Response
+		if err = send(ctx, o, chat.Method, chat.Path, payload, &chatResponse); err == nil {
+			reply, err = chatReply(&chatResponse)
+		}
+		if err == nil {
+			var texts []string
+			for _, c := range chatResponse.Choices {
+				texts = append(texts, c.Message.Content)
+			}
+			showChoices(o.UI, texts)
+		}
+	}
 	if err != nil {
 		return nil, err
 	}
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", os.Getenv("OPENAI_API_KEY")))
 
-	client := &http.Client{}
-	resp, err := client.Do(req)
+	conv.add(chat.RoleUser, prompt)
+	conv.add(chat.RoleAssistant, reply.Text)
+	return reply, nil
+}
+
+// chatReply extracts the reply from a chat response.
+func chatReply(r *chat.Response) (*apiReply, error) {
+	if len(r.Choices) == 0 {
+		return nil, noChoices()
+	}
+	c := r.Choices[0]
+	return &apiReply{
+		Text:         c.Message.Content,
+		FinishReason: c.FinishReason,
+		Usage:        r.Usage,
+	}, nil
+}
+
+// completion sends prompt to the completions endpoint and shows the
+// reply on the UI.
+func completion(ctx context.Context, o *plugin.Options, cfg config, prompt string) (*apiReply, error) {
+	s, err := samplingOf(cfg)
 	if err != nil {
 		return nil, err
 	}
-	defer resp.Body.Close()
+	payload := &completions.Request{
+		Prompt:           prompt,
+		Model:            cfg.Model,
+		MaxTokens:        cfg.MaxTokens,
+		Temperature:      cfg.Temperature,
+		TopP:             cfg.TopP,
+		N:                cfg.N,
+		Stop:             s.stop,
+		PresencePenalty:  cfg.PresencePenalty,
+		FrequencyPenalty: cfg.FrequencyPenalty,
+		Seed:             cfg.Seed,
+		LogitBias:        s.logitBias,
+		User:             cfg.User,
+		Stream:           streams(cfg),
+	}
 
-	body, _ := io.ReadAll(resp.Body)
+	if payload.Stream {
+		payload.StreamOptions = &completions.StreamOptions{IncludeUsage: true}
+		return streamCompletion(ctx, o, payload)
+	}
 
 	var completionResponse completions.Response
-	err = json.Unmarshal(body, &completionResponse)
+	if err := send(ctx, o, completions.Method, completions.Path, payload, &completionResponse); err != nil {
+		return nil, err
+	}
+	reply, err := completionReply(&completionResponse)
 	if err != nil {
 		return nil, err
 	}
+	var texts []string
+	for _, c := range completionResponse.Choices {
+		texts = append(texts, c.Text)
+	}
+	showChoices(o.UI, texts)
+	return reply, nil
+}
+
+// completionReply extracts the reply from a completions response.
+func completionReply(r *completions.Response) (*apiReply, error) {
+	if len(r.Choices) == 0 {
+		return nil, noChoices()
+	}
+	c := r.Choices[0]
+	return &apiReply{
+		Text:         c.Text,
+		FinishReason: c.FinishReason,
+		Usage:        chat.Usage(r.Usage),
+	}, nil
+}
+
+// streams returns true if replies to requests made with cfg are
+// streamed. Requests for several choices are not, as the choices
+// would be interleaved.
+func streams(cfg config) bool {
+	return cfg.Stream && cfg.N <= 1
+}
+
+// showChoices shows the text of every choice of a reply on ui, under
+// a header if there are several. The first choice is the one kept in
+// the conversation.
+func showChoices(ui plugin.UI, texts []string) {
+	for i, text := range texts {
+		if len(texts) > 1 {
+			ui.Print(fmt.Sprintf("[choice %d]", i+1))
+		}
+		show(ui, text)
+	}
+}
+
+// show shows the whole text of a reply on ui.
+func show(ui plugin.UI, text string) {
+	p := newDeltaPrinter(ui)
+	p.print(text)
+	p.done()
+}
+
+// errCanceled is returned when a request is canceled, typically
+// because the user pressed Ctrl-C.
+var errCanceled = errors.New("request canceled")
+
+// finishInterrupted is the finish reason of replies that were
+// interrupted while being streamed.
+const finishInterrupted = "interrupted"
+
+// noChoices returns the error reported when a response carries no choices.
+func noChoices() error {
+	return errors.New("unable to generate a response")
+}
+
+// send encodes payload as JSON, sends it to the endpoint at path and
+// decodes the JSON response into v.
+func send(ctx context.Context, o *plugin.Options, method, path string, payload, v any) error {
+	resp, err := do(ctx, o, method, path, payload)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		if ctx.Err() != nil {
+			return errCanceled
+		}
+		return err
+	}
+
+	if err := json.Unmarshal(body, v); err != nil {
+		return fmt.Errorf("could not decode response: %v", err)
+	}
+	return nil
+}
+
+// do encodes payload, if any, as JSON and sends it to the endpoint at
+// path, retrying transient failures as configured. Responses with a
+// non-2xx status code are returned as an *apiError. Otherwise, the
+// caller must close the body of the response.
+func do(ctx context.Context, o *plugin.Options, method, path string, payload any) (*http.Response, error) {
+	var data []byte
+	if payload != nil {
+		var err error
+		if data, err = json.Marshal(payload); err != nil {
+			return nil, err
+		}
+	}
 
-	if len(completionResponse.Choices) == 0 {
-		if os.Getenv("OPENAI_API_KEY") == "" {
-			return strings.Fields("vyx: missing OPENAI_API_KEY"), nil
+	cfg := currentConfig()
+	attempts := cfg.MaxRetries + 1
+	for attempt := 1; ; attempt++ {
+		resp, err := doOnce(ctx, o, method, path, data)
+		if err == nil {
+			return resp, nil
+		}
+		if ctx.Err() != nil {
+			return nil, errCanceled
+		}
+		if attempt >= attempts {
+			return nil, err
+		}
+		wait, ok := retryDelay(err, attempt, time.Duration(cfg.MaxRetryWait*float64(time.Second)))
+		if !ok {
+			return nil, err
+		}
+		o.UI.PrintErr(fmt.Sprintf("%v; retrying in %s (attempt %d/%d)", err, formatWait(wait), attempt+1, attempts))
+		t := time.NewTimer(wait)
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			t.Stop()
+			return nil, errCanceled
 		}
-		return strings.Fields("vyx: unable to generate a response"), nil
 	}
-	choice := completionResponse.Choices[0]
-	text := choice.Text
+}
 
-	return strings.Fields(text), nil
+// doOnce sends data, if any, to the endpoint at path.
+func doOnce(ctx context.Context, o *plugin.Options, method, path string, data []byte) (*http.Response, error) {
+	var body io.Reader
+	if data != nil {
+		body = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, o.BaseURL+path, body)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", os.Getenv("OPENAI_API_KEY")))
+
+	resp, err := o.HTTPClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode/100 != 2 {
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", resp.Status, err)
+		}
+		return nil, responseError(resp, body)
+	}
+	return resp, nil
 }
@@ -0,0 +1,487 @@
+// MIT License
+//
+// Copyright (c) 2023 Kevin Herro
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+package driver
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/kevherro/vyx/internal/plugin"
+)
+
+// attachRef matches the references to files in a prompt: words starting
+// with "@". A leading "@@" stands for a literal "@".
+var attachRef = regexp.MustCompile(`(^|\s)@(@?)([^\s@]\S*)`)
+
+// lineRange matches references to a range of lines of a file, such as
+// file.go:10-40, file.go:10- or file.go:10.
+var lineRange = regexp.MustCompile(`^(.+):(\d+)(-(\d*))?$`)
+
+// ignoreFileName is the name of the files listing what is not
+// attached from the directory holding them, like .gitignore does.
+const ignoreFileName = ".vyxignore"
+
+// attachment is a file, or a range of its lines, attached to a prompt.
+type attachment struct {
+	path       string // Path of the file, as referenced.
+	start, end int    // The lines attached, 0 for the whole file.
+	text       string
+}
+
+// name returns the name of a, its path followed by its lines if only
+// some of them are attached.
+func (a attachment) name() string {
+	if a.start == 0 {
+		return a.path
+	}
+	return fmt.Sprintf("%s:%d-%d", a.path, a.start, a.end)
+}
+
+// String formats a for a prompt: a header naming the file followed
+// by its text, fenced and tagged with its language.
+func (a attachment) String() string {
+	fence := "```"
+	for strings.Contains(a.text, fence) {
+		fence += "`"
+	}
+	text := a.text
+	if !strings.HasSuffix(text, "\n") {
+		text += "\n"
+	}
+	return fmt.Sprintf("%s:\n%s%s\n%s%s", a.name(), fence, language(a.path), text, fence)
+}
+
+// attach replaces the references to files in prompt by their paths,
+// and appends the files to the prompt. References are to files, globs,
+// ranges of lines of files and directories. References to files that
+// do not exist are left as they are, unless they have a glob or a line
+// range. Files attached may not exceed limit bytes altogether.
+func attach(prompt string, limit int) (string, []attachment, error) {
+	var b strings.Builder
+	var atts []attachment
+	seen := map[string]bool{}
+	size := 0
+	last := 0
+	for _, m := range attachRef.FindAllStringSubmatchIndex(prompt, -1) {
+		at := m[3] // Index of the "@".
+		ref := prompt[m[6]:m[7]]
+		b.WriteString(prompt[last:at])
+		last = m[7]
+		if m[5] > m[4] {
+			b.WriteString("@" + ref)
+			continue
+		}
+
+		// Punctuation following a reference is not part of it,
+		// unless a file is named that way.
+		var found []attachment
+		var err error
+		trail := ""
+		for {
+			if found, err = resolve(ref, limit-size); err == nil {
+				break
+			}
+			p := strings.TrimRight(ref, ".,;:!?)")
+			if p == ref || p == "" {
+				break
+			}
+			trail = ref[len(p):] + trail
+			ref = p
+		}
+		var lerr *limitError
+		if errors.As(err, &lerr) {
+			return "", nil, lerr.attachError(limit)
+		}
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) && !isFileRef(ref) {
+				// Not a file, but maybe an annotation, a package or a
+				// handle, as in "@Override", "@types/node" or "@alice".
+				b.WriteString("@" + ref + trail)
+				continue
+			}
+			return "", nil, fmt.Errorf("@%s: %v", ref+trail, err)
+		}
+		b.WriteString(ref + trail)
+
+		for _, a := range found {
+			if seen[a.name()] {
+				continue
+			}
+			seen[a.name()] = true
+			if size += len(a.text); size > limit {
+				return "", nil, (&limitError{a.name()}).attachError(limit)
+			}
+			atts = append(atts, a)
+		}
+	}
+	b.WriteString(prompt[last:])
+
+	for _, a := range atts {
+		b.WriteString("\n\n" + a.String())
+	}
+	return b.String(), atts, nil
+}
+
+// isFileRef returns true if ref can only be meant as a reference to
+// files, having a glob or a line range.
+func isFileRef(ref string) bool {
+	return strings.ContainsAny(ref, "*?[") || lineRange.MatchString(ref)
+}
+
+// limitError is returned when attaching the file at path would exceed
+// the limit of the size of attachments.
+type limitError struct {
+	path string
+}
+
+func (e *limitError) Error() string {
+	return e.path + " exceeds the size left for attachments"
+}
+
+// attachError returns the error reported to the user for e, given the
+// limit of attachments in bytes.
+func (e *limitError) attachError(limit int) error {
+	return fmt.Errorf("attachments exceed attach_limit of %d KiB at %s; attach fewer files or raise the limit",
+		limit/1024, e.path)
+}
+
+// resolve returns the files referenced by ref, reading them. It fails
+// with a *limitError as soon as they would take more than budget bytes,
+// without reading the rest.
+func resolve(ref string, budget int) ([]attachment, error) {
+	path, start, end := ref, 0, 0
+	if _, err := os.Stat(ref); err != nil {
+		if m := lineRange.FindStringSubmatch(ref); m != nil {
+			path = m[1]
+			start, _ = strconv.Atoi(m[2])
+			end = start
+			if m[3] != "" {
+				end = -1 // Up to the last line.
+				if m[4] != "" {
+					end, _ = strconv.Atoi(m[4])
+				}
+			}
+			if start < 1 || end != -1 && end < start {
+				return nil, fmt.Errorf("invalid line range %s", ref[len(path)+1:])
+			}
+		}
+	}
+
+	paths := []string{path}
+	if strings.ContainsAny(path, "*?[") {
+		var err error
+		if paths, err = filepath.Glob(path); err != nil {
+			return nil, err
+		}
+		if len(paths) == 0 {
+			return nil, fmt.Errorf("no files match")
+		}
+	}
+
+	var atts []attachment
+	for _, p := range paths {
+		fi, err := os.Stat(p)
+		if err != nil {
+			return nil, err
+		}
+		if !fi.IsDir() {
+			a, err := readAttachment(p, start, end, budget)
+			if err != nil {
+				return nil, err
+			}
+			budget -= len(a.text)
+			atts = append(atts, a)
+			continue
+		}
+		if start != 0 {
+			return nil, fmt.Errorf("%s is a directory, line ranges only apply to files", p)
+		}
+		err = walkDir(p, func(path string) error {
+			a, err := readAttachment(path, 0, 0, budget)
+			switch {
+			case err == errBinary:
+				return nil
+			case err != nil:
+				return err
+			}
+			budget -= len(a.text)
+			atts = append(atts, a)
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return atts, nil
+}
+
+// errBinary is returned for files that do not hold text.
+var errBinary = errors.New("not a text file")
+
+// binarySniffLen is how much of a file too large to attach is read to
+// tell whether it holds text, as binary files are skipped instead.
+const binarySniffLen = 8000
+
+// readAttachment reads the lines from start to end of the file at
+// path, or the whole file if start is 0. An end of -1 stands for the
+// last line. It fails with a *limitError if the text read would take
+// more than budget bytes, reading no more of the file than needed to
+// tell.
+func readAttachment(path string, start, end, budget int) (attachment, error) {
+	a := attachment{path: filepath.ToSlash(filepath.Clean(path))}
+	f, err := os.Open(path)
+	if err != nil {
+		return attachment{}, err
+	}
+	defer f.Close()
+	r := bufio.NewReader(f)
+
+	if start == 0 {
+		fi, err := f.Stat()
+		if err != nil {
+			return attachment{}, err
+		}
+		if fi.Size() > int64(budget) {
+			if head, _ := r.Peek(binarySniffLen); bytes.IndexByte(head, 0) != -1 {
+				return attachment{}, errBinary
+			}
+			return attachment{}, &limitError{a.path}
+		}
+		data, err := io.ReadAll(r)
+		if err != nil {
+			return attachment{}, err
+		}
+		if bytes.IndexByte(data, 0) != -1 {
+			return attachment{}, errBinary
+		}
+		a.text = string(data)
+		return a, nil
+	}
+
+	// Only the lines in the range are kept, the file may be large.
+	var text strings.Builder
+	n := 0
+	for end == -1 || n < end {
+		line, err := r.ReadString('\n')
+		if line != "" {
+			n++
+		}
+		if strings.IndexByte(line, 0) != -1 {
+			return attachment{}, errBinary
+		}
+		if line != "" && n >= start {
+			if text.Len()+len(line) > budget {
+				return attachment{}, &limitError{a.path}
+			}
+			text.WriteString(line)
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return attachment{}, err
+		}
+	}
+	if start > n {
+		return attachment{}, fmt.Errorf("%s has %d lines", a.path, n)
+	}
+	if end == -1 || end > n {
+		end = n
+	}
+	a.start, a.end = start, end
+	a.text = text.String()
+	return a, nil
+}
+
+// ignoreRule is a pattern of an ignore file.
+type ignoreRule struct {
+	dir     string // The directory holding the ignore file.
+	pattern string
+	dirOnly bool // Whether the pattern only matches directories.
+}
+
+// match returns true if the rule applies to path, which is a
+// directory if dir is true.
+func (r ignoreRule) match(path string, dir bool) bool {
+	if r.dirOnly && !dir {
+		return false
+	}
+	rel, err := filepath.Rel(r.dir, path)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		return false
+	}
+	rel = filepath.ToSlash(rel)
+	if strings.Contains(r.pattern, "/") {
+		ok, _ := filepath.Match(r.pattern, rel)
+		return ok
+	}
+	ok, _ := filepath.Match(r.pattern, filepath.Base(path))
+	return ok
+}
+
+// readIgnoreFile returns the rules of the ignore file in dir, if any.
+// Like in .gitignore files, lines list patterns matching the base names
+// of files, or their paths if they contain a slash. Patterns ending with
+// a slash only match directories. Empty lines and lines starting with
+// "#" are skipped.
+func readIgnoreFile(dir string) ([]ignoreRule, error) {
+	f, err := os.Open(filepath.Join(dir, ignoreFileName))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer f.Close()
+
+	var rules []ignoreRule
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		r := ignoreRule{dir: dir}
+		line, r.dirOnly = strings.CutSuffix(line, "/")
+		r.pattern = strings.TrimPrefix(line, "/")
+		rules = append(rules, r)
+	}
+	return rules, s.Err()
+}
+
+// walkDir calls visit with the files in the tree rooted at root, less
+// hidden ones and those matched by ignore files. The walk stops at the
+// first error returned by visit.
+func walkDir(root string, visit func(path string) error) error {
+	var rules []ignoreRule
+	return filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		ignored := path != root && strings.HasPrefix(d.Name(), ".")
+		for _, r := range rules {
+			ignored = ignored || r.match(path, d.IsDir())
+		}
+		switch {
+		case ignored && d.IsDir():
+			return filepath.SkipDir
+		case ignored:
+			return nil
+		case d.IsDir():
+			more, err := readIgnoreFile(path)
+			rules = append(rules, more...)
+			return err
+		case d.Type().IsRegular():
+			return visit(path)
+		}
+		return nil
+	})
+}
+
+// languages holds the languages of fenced code blocks, keyed by file
+// name extension, or by base name for files without one.
+var languages = map[string]string{
+	".c": "c", ".h": "c", ".cc": "cpp", ".cpp": "cpp", ".hpp": "cpp",
+	".cs": "csharp", ".css": "css", ".go": "go", ".html": "html",
+	".java": "java", ".js": "javascript", ".json": "json", ".kt": "kotlin",
+	".lua": "lua", ".md": "markdown", ".php": "php", ".proto": "protobuf",
+	".py": "python", ".rb": "ruby", ".rs": "rust", ".scala": "scala",
+	".sh": "bash", ".sql": "sql", ".swift": "swift", ".toml": "toml",
+	".ts": "typescript", ".tsx": "tsx", ".jsx": "jsx", ".xml": "xml",
+	".yaml": "yaml", ".yml": "yaml", ".mod": "go-mod",
+	"Dockerfile": "dockerfile", "Makefile": "makefile",
+}
+
+// language returns the language of the file at path, empty if unknown.
+func language(path string) string {
+	if ext := filepath.Ext(path); ext != "" {
+		return languages[ext]
+	}
+	return languages[filepath.Base(path)]
+}
+
+// estimateTokens returns a rough estimate of the tokens holding text,
+// assuming four bytes per token.
+func estimateTokens(text string) int {
+	return (len(text) + 3) / 4
+}
+
+// contextError reports a prompt whose attachments would make a request
+// exceed the context window of the model.
+type contextError struct {
+	model  string
+	window int // Size of the context window of model, in tokens.
+	tokens int // Estimated size of the request, in tokens.
+	atts   []attachment
+}
+
+func (e *contextError) Error() string {
+	atts := append([]attachment(nil), e.atts...)
+	sort.SliceStable(atts, func(i, j int) bool { return len(atts[i].text) > len(atts[j].text) })
+	var b strings.Builder
+	fmt.Fprintf(&b, "prompt not sent: it would take about %d tokens with its attachments, more than the %d tokens of the context window of %s",
+		e.tokens, e.window, e.model)
+	for _, a := range atts {
+		fmt.Fprintf(&b, "\n  %s: about %d tokens", a.name(), estimateTokens(a.text))
+	}
+	return b.String()
+}
+
+// checkContext returns a *contextError if sending prompt, whose files
+// are atts, along with conv would likely exceed the context window of
+// the configured model. Prompts without attachments are not checked.
+func checkContext(cfg config, conv *conversation, prompt string, atts []attachment) error {
+	window, ok := contextWindow(cfg.Model)
+	if len(atts) == 0 || !ok {
+		return nil
+	}
+	tokens := estimateTokens(prompt) + cfg.MaxTokens
+	if cfg.Endpoint == "chat" {
+		if system, err := systemMessage(cfg); err == nil {
+			tokens += estimateTokens(system)
+		}
+		for _, m := range conv.messages {
+			tokens += estimateTokens(m.Content)
+		}
+	}
+	if tokens <= window {
+		return nil
+	}
+	return &contextError{model: cfg.Model, window: window, tokens: tokens, atts: atts}
+}
+
+// reportAttachments shows the files attached to a prompt on ui.
+func reportAttachments(ui plugin.UI, atts []attachment) {
+	if len(atts) == 0 {
+		return
+	}
+	var names []string
+	tokens := 0
+	for _, a := range atts {
+		names = append(names, a.name())
+		tokens += estimateTokens(a.text)
+	}
+	ui.Print(fmt.Sprintf("attached %s (about %d tokens)", strings.Join(names, ", "), tokens))
+}
@@ -0,0 +1,198 @@
+// MIT License
+//
+// Copyright (c) 2023 Kevin Herro
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+package driver
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestAttach(t *testing.T) {
+	dir := t.TempDir()
+	for name, data := range map[string]string{
+		"main.go":          "package main\n\nfunc main() {}\n",
+		"notes.txt":        "one\ntwo\nthree\nfour\n",
+		"tree/a.py":        "print('a')\n",
+		"tree/b.bin":       "\x00\x01",
+		"tree/gen/x.go":    "package gen\n",
+		"tree/skip.log":    "log\n",
+		"tree/.hidden":     "hidden\n",
+		"tree/.vyxignore":  "# generated\ngen/\n*.log\n",
+		"tree/sub/c.md":    "# C\n",
+		"fence/code.md":    "```go\nx\n```\n",
+		"with space/x.txt": "x\n",
+	} {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	p := filepath.ToSlash(dir) + "/"
+
+	for _, tc := range []struct {
+		prompt string
+		want   string
+		limit  int
+		err    string
+	}{
+		{
+			prompt: "explain @" + p + "main.go.",
+			want:   "explain " + p + "main.go.\n\n" + p + "main.go:\n```go\npackage main\n\nfunc main() {}\n```",
+		},
+		{
+			prompt: "@" + p + "notes.txt:2-3 and @" + p + "notes.txt:4-",
+			want: p + "notes.txt:2-3 and " + p + "notes.txt:4-\n\n" +
+				p + "notes.txt:2-3:\n```\ntwo\nthree\n```\n\n" + p + "notes.txt:4-4:\n```\nfour\n```",
+		},
+		{
+			prompt: "@" + p + "tree",
+			want: p + "tree\n\n" + p + "tree/a.py:\n```python\nprint('a')\n```\n\n" +
+				p + "tree/sub/c.md:\n```markdown\n# C\n```",
+		},
+		{
+			prompt: "@" + p + "*.go @" + p + "main.go",
+			want:   p + "*.go " + p + "main.go\n\n" + p + "main.go:\n```go\npackage main\n\nfunc main() {}\n```",
+		},
+		{
+			prompt: "@" + p + "fence/code.md",
+			want:   p + "fence/code.md\n\n" + p + "fence/code.md:\n````markdown\n```go\nx\n```\n````",
+		},
+		{prompt: "mail me@example.com @@home", want: "mail me@example.com @home"},
+		{prompt: "what does @Override do in java?", want: "what does @Override do in java?"},
+		{prompt: "@dataclass\nclass Point:", want: "@dataclass\nclass Point:"},
+		{prompt: "npm i @types/node, then ping @alice.", want: "npm i @types/node, then ping @alice."},
+		{prompt: "see @" + p + "missing.go", want: "see @" + p + "missing.go"},
+		{prompt: "@" + p + "missing.go:1-2", err: "no such file"},
+		{prompt: "@" + p + "*.rs", err: "no files match"},
+		{prompt: "@" + p + "notes.txt:9", err: "has 4 lines"},
+		{prompt: "@" + p + "notes.txt:3-2", err: "invalid line range 3-2"},
+		{prompt: "@" + p + "tree:1-2", err: "line ranges only apply to files"},
+		{prompt: "@" + p + "notes.txt", limit: 10, err: "attachments exceed attach_limit"},
+	} {
+		limit := tc.limit
+		if limit == 0 {
+			limit = 1 << 20
+		}
+		got, _, err := attach(tc.prompt, limit)
+		switch {
+		case tc.err != "":
+			if err == nil || !strings.Contains(err.Error(), tc.err) {
+				t.Errorf("attach(%q) returned error %v, want %q", tc.prompt, err, tc.err)
+			}
+		case err != nil:
+			t.Errorf("attach(%q): %v", tc.prompt, err)
+		case got != tc.want:
+			t.Errorf("attach(%q) =\n%s\nwant\n%s", tc.prompt, got, tc.want)
+		}
+	}
+}
+
+func TestAttachLimit(t *testing.T) {
+	// Sparse files far too large to be read in memory, starting with
+	// text or holding none.
+	dir := t.TempDir()
+	for name, head := range map[string]string{
+		"huge/log.txt": "first line\n" + strings.Repeat("more text\n", 1000),
+		"bin/data":     "",
+	} {
+		fname := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(fname), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(fname, []byte(head), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Truncate(fname, 64<<30); err != nil {
+			t.Skipf("cannot create a sparse file: %v", err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(dir, "bin", "notes.txt"), []byte("notes\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	p := filepath.ToSlash(dir) + "/"
+
+	for _, tc := range []struct {
+		prompt string
+		want   string
+		err    string
+	}{
+		{prompt: "@" + p + "huge", err: "attachments exceed attach_limit of 1 KiB at " + p + "huge/log.txt"},
+		{prompt: "@" + p + "huge/log.txt", err: "attachments exceed attach_limit of 1 KiB at " + p + "huge/log.txt"},
+		{prompt: "@" + p + "huge/log.txt:1", want: p + "huge/log.txt:1\n\n" + p + "huge/log.txt:1-1:\n```\nfirst line\n```"},
+		{prompt: "@" + p + "bin", want: p + "bin\n\n" + p + "bin/notes.txt:\n```\nnotes\n```"},
+	} {
+		got, _, err := attach(tc.prompt, 1024)
+		switch {
+		case tc.err != "":
+			if err == nil || !strings.Contains(err.Error(), tc.err) {
+				t.Errorf("attach(%q) returned error %v, want %q", tc.prompt, err, tc.err)
+			}
+		case err != nil:
+			t.Errorf("attach(%q): %v", tc.prompt, err)
+		case got != tc.want:
+			t.Errorf("attach(%q) =\n%s\nwant\n%s", tc.prompt, got, tc.want)
+		}
+	}
+}
+
+func TestAttachContext(t *testing.T) {
+	srv, ui, o := setup(t, nil)
+	sh := &shell{o: o, conv: &conversation{}}
+	ctx := context.Background()
+	fname := filepath.Join(t.TempDir(), "big.txt")
+	if err := os.WriteFile(fname, []byte(strings.Repeat("word ", 10000)), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := configure("model", "gpt-4"); err != nil {
+		t.Fatal(err)
+	}
+	if err := sh.execute(ctx, "summarize @"+fname); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := ui.errs.String(), "context window of gpt-4\n  "+fname+": about 12500 tokens"; !strings.Contains(got, want) {
+		t.Errorf("got errors\n%s\nwant them to contain %q", got, want)
+	}
+	if n := len(srv.Requests()); n != 0 {
+		t.Errorf("got %d requests, want none", n)
+	}
+
+	if err := configure("model", "gpt-4o"); err != nil {
+		t.Fatal(err)
+	}
+	if err := sh.execute(ctx, "summarize @"+fname); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := ui.out.String(), "attached "+fname+" (about 12500 tokens)"; !strings.Contains(got, want) {
+		t.Errorf("got output\n%s\nwant it to contain %q", got, want)
+	}
+	req, ok := srv.LastRequest()
+	if !ok {
+		t.Fatal("no request sent")
+	}
+	chatReq, err := req.Chat()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := chatReq.Messages[0].Content; !strings.HasPrefix(got, "summarize "+fname+"\n\n"+fname+":\n```\nword ") {
+		t.Errorf("got prompt %.100q, want the file attached", got)
+	}
+}
@@ -13,3 +13,212 @@
 // all copies or substantial portions of the Software.
 
 package driver
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+
+	"github.com/kevherro/vyx/internal/plugin"
+)
+
+const usageHeader = `usage: vyx [flags] [prompt ...]
+
+Sends the prompt, followed by any input piped through stdin, to the
+configured endpoint, prints the reply on stdout and exits. Without a
+prompt or piped input, vyx starts an interactive session. Words of the
+prompt starting with @ attach files, as in "explain @main.go:10-40".
+
+Every config field can be set with a flag of the same name, and every
+choice of a multi-choice field with a boolean flag.
+
+Exit status is 0 on success, 2 for usage errors, 3 if authentication
+failed, 4 if rate limited, 5 if the request was invalid, 6 if the prompt
+does not fit the context window, 7 for server errors, 130 if the request
+was interrupted with Ctrl-C, and 1 otherwise.
+
+Flags:
+`
+
+// usageError is returned when vyx is invoked incorrectly.
+type usageError struct {
+	err error
+}
+
+func (e *usageError) Error() string {
+	return e.err.Error()
+}
+
+// Exit statuses reported by ExitStatus.
+const (
+	exitOK             = 0
+	exitFailure        = 1 // The request failed.
+	exitUsage          = 2 // vyx was invoked incorrectly.
+	exitAuth           = 3 // The API rejected the API key.
+	exitRateLimit      = 4 // The API rate limited the request.
+	exitInvalidRequest = 5 // The API rejected the request.
+	exitContextLength  = 6 // The prompt does not fit the context window.
+	exitServer         = 7 // The API failed to process the request.
+
+	exitInterrupted = 130 // The request was canceled with Ctrl-C.
+)
+
+// ExitStatus returns the status the process should exit with
+// after Vyx returned err.
+func ExitStatus(err error) int {
+	var uerr *usageError
+	var aerr *apiError
+	var cerr *contextError
+	switch {
+	case err == nil:
+		return exitOK
+	case errors.As(err, &uerr):
+		return exitUsage
+	case errors.Is(err, errCanceled):
+		return exitInterrupted
+	case errors.As(err, &cerr):
+		return exitContextLength
+	case errors.As(err, &aerr):
+		switch aerr.kind {
+		case errAuth:
+			return exitAuth
+		case errRateLimit:
+			return exitRateLimit
+		case errInvalidRequest:
+			return exitInvalidRequest
+		case errContextLength:
+			return exitContextLength
+		case errServer:
+			return exitServer
+		}
+	}
+	return exitFailure
+}
+
+// cli runs vyx as requested by the command-line arguments o.Args.
+// If they hold a prompt or input is piped through o.Stdin, it sends a
+// single request, prints the reply on o.Stdout and returns. Otherwise
+// it starts an interactive session.
+func cli(o *plugin.Options) error {
+	prompt, err := parseFlags(o.UI, o.Args)
+	if err != nil {
+		if err == flag.ErrHelp {
+			return nil
+		}
+		return &usageError{err}
+	}
+
+	input, piped, err := readPiped(o.Stdin)
+	if err != nil {
+		return err
+	}
+	if !piped && prompt == "" {
+		return interactive(o)
+	}
+
+	// Only the prompt may reference files, not the piped input.
+	cfg := currentConfig()
+	prompt, atts, err := attach(prompt, cfg.AttachLimit*1024)
+	if err != nil {
+		return err
+	}
+	if input = strings.TrimSpace(input); input != "" {
+		if prompt != "" {
+			prompt += "\n\n"
+		}
+		prompt += input
+	}
+	if prompt == "" {
+		return &usageError{errors.New("empty prompt")}
+	}
+	conv := &conversation{}
+	if err := checkContext(cfg, conv, prompt, atts); err != nil {
+		return err
+	}
+	reportAttachments(o.UI, atts)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	if err := askTo(ctx, o, conv, prompt, outputFor(cfg), o.Stdout); err != nil {
+		return err
+	}
+	if ctx.Err() != nil {
+		// The reply was interrupted, even if part of it was printed.
+		return errCanceled
+	}
+	return nil
+}
+
+// parseFlags parses the command-line arguments args, assigning the value
+// of every flag to the corresponding config field. It returns the prompt
+// held by the remaining arguments.
+func parseFlags(ui plugin.UI, args []string) (string, error) {
+	fs := flag.NewFlagSet("vyx", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	for _, f := range configFields {
+		fs.Var(&configFlag{name: f.name, isBool: isBoolConfig(f.name)}, f.name, configHelp[f.name])
+		for _, choice := range f.choices {
+			fs.Var(&configFlag{name: choice, isBool: true}, choice, fmt.Sprintf("set %s to %s", f.name, choice))
+		}
+	}
+
+	if err := fs.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			var usage bytes.Buffer
+			usage.WriteString(usageHeader)
+			fs.SetOutput(&usage)
+			fs.PrintDefaults()
+			ui.Print(usage.String())
+		}
+		return "", err
+	}
+	return strings.Join(fs.Args(), " "), nil
+}
+
+// configFlag is a flag.Value that assigns the config field or choice
+// it is named after.
+type configFlag struct {
+	name   string
+	isBool bool
+}
+
+func (c *configFlag) String() string {
+	if c == nil || c.name == "" {
+		// Called by the flag package on a zero value.
+		return ""
+	}
+	f := configFieldMap[c.name]
+	if f.name != c.name || (c.isBool && f.defaultValue == "false") {
+		return ""
+	}
+	return f.defaultValue
+}
+
+func (c *configFlag) Set(value string) error {
+	return configure(c.name, value)
+}
+
+func (c *configFlag) IsBoolFlag() bool {
+	return c.isBool
+}
+
+// readPiped returns the contents of stdin if it is not a terminal.
+func readPiped(stdin io.Reader) (string, bool, error) {
+	if stdin == nil {
+		return "", false, nil
+	}
+	if f, ok := stdin.(*os.File); ok && isTerminal(f) {
+		return "", false, nil
+	}
+	b, err := io.ReadAll(stdin)
+	if err != nil {
+		return "", false, err
+	}
+	return string(b), true, nil
+}
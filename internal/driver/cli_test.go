@@ -0,0 +1,208 @@
+// MIT License
+//
+// Copyright (c) 2023 Kevin Herro
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+package driver
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/kevherro/vyx/internal/apitest"
+)
+
+func TestCLI(t *testing.T) {
+	big := filepath.Join(t.TempDir(), "big.txt")
+	if err := os.WriteFile(big, []byte(strings.Repeat("word ", 160000)), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		desc   string
+		args   []string
+		stdin  string // Piped input, if not empty.
+		reply  apitest.Reply
+		prompt string // The prompt sent, or empty if no request is sent.
+		status int
+	}{
+		{
+			desc:   "prompt",
+			args:   []string{"hello", "world"},
+			reply:  apitest.Reply{Text: "Hi."},
+			prompt: "hello world",
+		},
+		{
+			desc:   "piped input",
+			args:   []string{"summarize"},
+			stdin:  "line one\nline two\n",
+			reply:  apitest.Reply{Text: "Two lines."},
+			prompt: "summarize\n\nline one\nline two",
+		},
+		{
+			desc:   "piped input only",
+			stdin:  "just input",
+			reply:  apitest.Reply{Text: "Ok."},
+			prompt: "just input",
+		},
+		{
+			desc:   "empty piped input",
+			stdin:  " \n",
+			status: exitUsage,
+		},
+		{
+			desc:   "unknown flag",
+			args:   []string{"-bogus", "hi"},
+			status: exitUsage,
+		},
+		{
+			desc:   "invalid flag value",
+			args:   []string{"-temperature", "5", "hi"},
+			status: exitUsage,
+		},
+		{
+			desc:   "help",
+			args:   []string{"-help"},
+			status: exitOK,
+		},
+		{
+			desc:   "auth",
+			args:   []string{"hi"},
+			reply:  apitest.Reply{Status: http.StatusUnauthorized, ErrorType: "invalid_request_error", Message: "Incorrect API key provided."},
+			prompt: "hi",
+			status: exitAuth,
+		},
+		{
+			desc:   "rate limit",
+			args:   []string{"hi"},
+			reply:  apitest.Reply{Status: http.StatusTooManyRequests, ErrorType: "requests", Message: "slow down"},
+			prompt: "hi",
+			status: exitRateLimit,
+		},
+		{
+			desc:   "invalid request",
+			args:   []string{"hi"},
+			reply:  apitest.Reply{Status: http.StatusBadRequest, ErrorType: "invalid_request_error", Message: "bad temperature"},
+			prompt: "hi",
+			status: exitInvalidRequest,
+		},
+		{
+			desc:   "context length",
+			args:   []string{"hi"},
+			reply:  apitest.Reply{Status: http.StatusBadRequest, ErrorCode: "context_length_exceeded", Message: "too many tokens"},
+			prompt: "hi",
+			status: exitContextLength,
+		},
+		{
+			desc:   "too long to send",
+			args:   []string{"-attach_limit=1024", "summarize", "@" + big},
+			status: exitContextLength,
+		},
+		{
+			desc:   "server",
+			args:   []string{"hi"},
+			reply:  apitest.Reply{Status: http.StatusInternalServerError, ErrorType: "server_error", Message: "oops"},
+			prompt: "hi",
+			status: exitServer,
+		},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			srv, _, o := setup(t, func(srv *apitest.Server) {
+				srv.Push(tc.reply)
+			})
+			o.Args = append([]string{"-max_retries=0"}, tc.args...)
+			if tc.stdin != "" {
+				o.Stdin = strings.NewReader(tc.stdin)
+			}
+			var stdout strings.Builder
+			o.Stdout = &stdout
+
+			err := cli(o)
+			if got := ExitStatus(err); got != tc.status {
+				t.Errorf("got exit status %d (error %v), want %d", got, err, tc.status)
+			}
+			req, ok := srv.LastRequest()
+			if tc.prompt == "" {
+				if ok {
+					t.Errorf("sent a request, want none")
+				}
+				return
+			}
+			if !ok {
+				t.Fatal("sent no request")
+			}
+			creq, err := req.Chat()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if n := len(creq.Messages); n == 0 || creq.Messages[n-1].Content != tc.prompt {
+				t.Errorf("sent messages %v, want the prompt %q", creq.Messages, tc.prompt)
+			}
+			if tc.status == exitOK && strings.TrimSpace(stdout.String()) != tc.reply.Text {
+				t.Errorf("printed %q, want %q", stdout.String(), tc.reply.Text)
+			}
+		})
+	}
+}
+
+func TestCLIFlags(t *testing.T) {
+	srv, _, o := setup(t, func(srv *apitest.Server) {
+		srv.Push(apitest.Reply{Text: "Hi."})
+	})
+	o.Args = []string{"-temperature", "0.2", "-model=gpt-4o-mini", "-markdown", "-show_usage", "hi"}
+	o.Stdout = &strings.Builder{}
+	if err := cli(o); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := currentConfig()
+	if cfg.Temperature != 0.2 || cfg.Model != "gpt-4o-mini" || cfg.Format != "markdown" || !cfg.ShowUsage {
+		t.Errorf("flags set temperature=%v model=%s format=%s show_usage=%v, want 0.2, gpt-4o-mini, markdown and true",
+			cfg.Temperature, cfg.Model, cfg.Format, cfg.ShowUsage)
+	}
+	req, ok := srv.LastRequest()
+	if !ok {
+		t.Fatal("sent no request")
+	}
+	creq, err := req.Chat()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if creq.Temperature != 0.2 || creq.Model != "gpt-4o-mini" {
+		t.Errorf("sent temperature %v and model %s, want 0.2 and gpt-4o-mini", creq.Temperature, creq.Model)
+	}
+}
+
+func TestExitStatus(t *testing.T) {
+	for _, tc := range []struct {
+		err  error
+		want int
+	}{
+		{nil, exitOK},
+		{errors.New("failed"), exitFailure},
+		{&usageError{errors.New("bad flag")}, exitUsage},
+		{errCanceled, exitInterrupted},
+		{fmt.Errorf("reply: %w", errCanceled), exitInterrupted},
+		{&contextError{}, exitContextLength},
+		{&apiError{kind: errContextLength}, exitContextLength},
+		{fmt.Errorf("request: %w", &apiError{kind: errAuth}), exitAuth},
+	} {
+		if got := ExitStatus(tc.err); got != tc.want {
+			t.Errorf("ExitStatus(%v) = %d, want %d", tc.err, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,463 @@
+// MIT License
+//
+// Copyright (c) 2023 Kevin Herro
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+package driver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/kevherro/vyx/internal/plugin"
+)
+
+// shell holds the state of an interactive session
+// that is shared by commands.
+type shell struct {
+	o       *plugin.Options
+	conv    *conversation
+	session *session // Where conv is saved, nil until it is.
+	history *history // Input of this and earlier sessions, if available.
+
+	lastPrompt string // The last prompt sent, if any.
+}
+
+// command describes an interactive command.
+type command struct {
+	name        string
+	aliases     []string
+	usage       string // Arguments accepted by the command, if any.
+	description string
+
+	// minArgs and maxArgs bound the number of arguments the command
+	// accepts, anyArgs for maxArgs meaning no bound. Commands without
+	// them take no arguments.
+	minArgs, maxArgs int
+
+	// valid returns true if args, whose number the command accepts, are
+	// of the kinds it takes. Input that names the command but is not
+	// valid is a prompt. If nil, any arguments are valid.
+	valid func(args []string) bool
+
+	run func(ctx context.Context, sh *shell, args []string) error
+}
+
+// anyArgs is the maxArgs of commands taking any number of arguments.
+const anyArgs = -1
+
+// accepts returns true if c may be run with n arguments.
+func (c *command) accepts(n int) bool {
+	return n >= c.minArgs && (c.maxArgs == anyArgs || n <= c.maxArgs)
+}
+
+// runs returns true if input made of the name of c followed by args
+// runs c, rather than being a prompt.
+func (c *command) runs(args []string) bool {
+	return c.accepts(len(args)) && (c.valid == nil || c.valid(args))
+}
+
+// errExit is returned by a command to end the interactive session.
+var errExit = errors.New("exit")
+
+var (
+	commands []*command // Interactive commands, in the order they are listed.
+
+	// commandMap holds an entry for every command name and alias.
+	commandMap map[string]*command
+)
+
+func init() {
+	commands = []*command{
+		{
+			name:        "help",
+			usage:       "[<command> | <option>]",
+			description: "Show the available commands and options, or details about one of them.",
+			maxArgs:     1,
+			valid: func(args []string) bool {
+				return len(args) == 0 || isHelpTopic(args[0])
+			},
+			run: func(ctx context.Context, sh *shell, args []string) error {
+				if len(args) == 0 {
+					return commandHelp("", sh.o.UI)
+				}
+				return commandHelp(args[0], sh.o.UI)
+			},
+		},
+		{
+			name:        "options",
+			aliases:     []string{"o"},
+			description: "Show the current value of every option.",
+			run: func(ctx context.Context, sh *shell, args []string) error {
+				printCurrentOptions(sh.o.UI)
+				return nil
+			},
+		},
+		{
+			name:        "models",
+			usage:       "[<filter> ...]",
+			description: "List the available models, or those whose ID contains every filter.",
+			maxArgs:     anyArgs,
+			valid:       isModelFilter,
+			run: func(ctx context.Context, sh *shell, args []string) error {
+				return listModels(ctx, args, sh.o)
+			},
+		},
+		{
+			name:        "model",
+			usage:       "[<id>]",
+			description: "Describe a model, by default the one in use.",
+			maxArgs:     1,
+			valid: func(args []string) bool {
+				return len(args) == 0 || isModelID(args[0])
+			},
+			run: func(ctx context.Context, sh *shell, args []string) error {
+				if len(args) == 0 {
+					return describeModel(ctx, currentConfig().Model, sh.o)
+				}
+				return describeModel(ctx, args[0], sh.o)
+			},
+		},
+		{
+			name:        "show",
+			description: "Show the conversation so far.",
+			run: func(ctx context.Context, sh *shell, args []string) error {
+				if len(sh.conv.messages) == 0 {
+					sh.o.UI.Print("conversation is empty")
+					return nil
+				}
+				sh.o.UI.Print(sh.conv.String())
+				return nil
+			},
+		},
+		{
+			name:        "clear",
+			description: "Forget the conversation so far and start a new one. The saved session is kept.",
+			run: func(ctx context.Context, sh *shell, args []string) error {
+				sh.conv.clear()
+				sh.session = nil
+				return nil
+			},
+		},
+		{
+			name:        "drop",
+			description: "Forget the last prompt of the conversation and its reply.",
+			run: func(ctx context.Context, sh *shell, args []string) error {
+				if !sh.conv.dropLast() {
+					return errors.New("conversation is empty")
+				}
+				if sh.session == nil {
+					return nil
+				}
+				return sh.saveSession()
+			},
+		},
+		{
+			name:  "edit",
+			usage: "[last | <text>]",
+			description: "Compose a prompt in $VISUAL or $EDITOR, starting from text or the last prompt, " +
+				"and send it. With last, edit the last prompt of the conversation and generate its reply again.",
+			maxArgs: anyArgs,
+			run: func(ctx context.Context, sh *shell, args []string) error {
+				return sh.edit(ctx, args)
+			},
+		},
+		{
+			name:        "save",
+			description: "Save the current options to the settings file, in the active profile.",
+			run: func(ctx context.Context, sh *shell, args []string) error {
+				fname, err := saveSettings()
+				if err != nil {
+					return err
+				}
+				sh.o.UI.Print("settings saved to ", fname)
+				return nil
+			},
+		},
+		{
+			name:        "load",
+			description: "Restore the options saved in the settings file for the active profile.",
+			run: func(ctx context.Context, sh *shell, args []string) error {
+				return loadSettings()
+			},
+		},
+		{
+			name:  "profile",
+			usage: "[<name> | new <name> | copy <from> <to> | delete <name>]",
+			description: "Show the active profile, switch to another one, save the current " +
+				"options as a new profile, copy a profile or delete one.",
+			maxArgs: 3,
+			valid:   isProfileArgs,
+			run: func(ctx context.Context, sh *shell, args []string) error {
+				return profileCommand(args, sh.o.UI)
+			},
+		},
+		{
+			name:        "profiles",
+			description: "List the saved profiles.",
+			run: func(ctx context.Context, sh *shell, args []string) error {
+				return listProfiles(sh.o.UI)
+			},
+		},
+		{
+			name:        "persona",
+			usage:       "[<name> | none]",
+			description: "List the personas, preset system messages, or switch to one.",
+			maxArgs:     1,
+			valid: func(args []string) bool {
+				return len(args) == 0 || isPersona(args[0])
+			},
+			run: func(ctx context.Context, sh *shell, args []string) error {
+				return personaCommand(args, sh.o.UI)
+			},
+		},
+		{
+			name:        "history",
+			usage:       "[<n>]",
+			description: "List the latest entries of the input history, or run entry n again.",
+			maxArgs:     1,
+			valid: func(args []string) bool {
+				return len(args) == 0 || isHistoryEntry(args[0])
+			},
+			run: func(ctx context.Context, sh *shell, args []string) error {
+				entry, err := sh.historyCommand(args)
+				if err != nil || entry == "" {
+					return err
+				}
+				sh.o.UI.Print(entry)
+				sh.recordHistory(entry)
+				return sh.execute(ctx, entry)
+			},
+		},
+		{
+			name:        "sessions",
+			description: "List the saved sessions, most recent first.",
+			run: func(ctx context.Context, sh *shell, args []string) error {
+				return printSessions(sh.o.UI, sh.session)
+			},
+		},
+		{
+			name:  "session",
+			usage: "[resume <id> | rename <id> <title> | delete <id>]",
+			description: "Show the current session, resume a saved one, restoring its conversation " +
+				"and options, change the title of one or delete one. IDs can be abbreviated only to resume.",
+			maxArgs: anyArgs,
+			valid:   isSessionArgs,
+			run: func(ctx context.Context, sh *shell, args []string) error {
+				return sh.sessionCommand(args)
+			},
+		},
+		{
+			name:        "usage",
+			usage:       "[reset]",
+			description: "Show the tokens used and their estimated cost in this session, by model, or forget them.",
+			maxArgs:     1,
+			valid: func(args []string) bool {
+				return len(args) == 0 || args[0] == "reset"
+			},
+			run: func(ctx context.Context, sh *shell, args []string) error {
+				return usageCommand(args, sh.o.UI)
+			},
+		},
+		{
+			name:  "pricing",
+			usage: "[<model> <prompt> <completion>]",
+			description: "Show the prices used to estimate costs, or set the price of a model " +
+				"in USD per million prompt and completion tokens.",
+			maxArgs: 3,
+			valid:   isPriceArgs,
+			run: func(ctx context.Context, sh *shell, args []string) error {
+				return pricingCommand(args, sh.o.UI)
+			},
+		},
+		{
+			name:        "exit",
+			aliases:     []string{"quit", "q"},
+			description: "Exit vyx.",
+			run: func(ctx context.Context, sh *shell, args []string) error {
+				return errExit
+			},
+		},
+	}
+
+	commandMap = map[string]*command{}
+	for _, c := range commands {
+		commandMap[c.name] = c
+		for _, alias := range c.aliases {
+			commandMap[alias] = c
+		}
+	}
+}
+
+// configHelp contains help text per config field.
+var configHelp = map[string]string{
+	"output":      "File where replies are written. Replies are shown if empty.",
+	"output_mode": "Whether replies overwrite the output file or are appended to it.",
+	"format": "How replies shown on a terminal are rendered. markdown renders headings, lists, " +
+		"tables, emphasis and code blocks, wrapped to the width of the terminal and without colors " +
+		"if NO_COLOR is set. Replies are then shown line by line.",
+	"model":    "ID of the model to use. Type \"models\" for the available ones.",
+	"endpoint": "The OpenAI endpoint prompts are sent to.",
+	"max_tokens": "The maximum number of tokens to generate in a reply. If unset, the API " +
+		"default applies: the most the model can generate for chat, 16 for completions.",
+	"temperature": "What sampling temperature to use, between 0 and 2. Higher values " +
+		"make the output more random, lower values more focused and deterministic.",
+	"stream": "Show replies as they are generated.",
+	"system": "The system message of chat conversations, telling the model how to behave. " +
+		"\"@file\" reads it from a file.",
+	"persona": "The name of a preset system message, sent before the system option. " +
+		"Type \"persona\" for the list.",
+	"top_p": "Nucleus sampling: only the tokens comprising the top top_p probability mass " +
+		"are considered. Zero leaves the API default.",
+	"n": "How many choices to generate for each prompt. The first one is kept in the " +
+		"conversation. Replies with several choices are not streamed. Zero leaves the API default.",
+	"stop": "Up to 4 comma-separated sequences where the model stops generating. " +
+		"\\, stands for a comma, \\n for a newline and \\t for a tab.",
+	"presence_penalty": "Between -2 and 2. Positive values penalize tokens that already " +
+		"appear in the text, increasing the likelihood of new topics.",
+	"frequency_penalty": "Between -2 and 2. Positive values penalize tokens based on " +
+		"their frequency in the text, decreasing repetition.",
+	"seed": "Makes sampling deterministic on a best effort basis, if not zero.",
+	"logit_bias": "Comma-separated token:bias pairs, where bias is between -100 and 100, " +
+		"changing the likelihood of the token with that ID.",
+	"user":            "A unique identifier of the end user, to help the API detect abuse.",
+	"response_format": "The format of chat replies. json_object requires the prompt to ask for JSON.",
+	"max_retries":     "How many times to retry a request that failed with a transient error.",
+	"max_retry_wait": "The longest to wait before retrying a request, in seconds. " +
+		"Requests the server asks to retry later than that are not retried.",
+	"history": "Whether input is recorded in the history file. Input starting with a space " +
+		"never is. Accepts on and off.",
+	"multiline": "Read prompts over several lines, until an empty line. Commands and assignments " +
+		"are run as soon as they are entered. Accepts on and off.",
+	"attach_limit": "The most KiB of files that @path references may attach to a prompt, " +
+		"altogether.",
+	"show_usage": "Show the tokens used by every request and their estimated cost.",
+	"budget": "The most to spend in a session, in USD. Requests are refused once it is reached. " +
+		"Zero means no limit.",
+}
+
+// commandHelp shows help about the command or option named by args,
+// or a summary of every command and option if args is empty.
+func commandHelp(args string, ui plugin.UI) error {
+	if args == "" {
+		ui.Print(usage())
+		return nil
+	}
+	// Some names are both a command and an option.
+	var help []string
+	if c, ok := commandMap[args]; ok {
+		help = append(help, c.help())
+	}
+	if f, ok := configFieldMap[args]; ok {
+		help = append(help, f.help())
+	}
+	if len(help) == 0 {
+		return fmt.Errorf("unknown command or option %q, type \"help\" for the list", args)
+	}
+	ui.Print(strings.Join(help, "\n\n"))
+	return nil
+}
+
+// isHelpTopic returns true if name is that of a command or an option.
+func isHelpTopic(name string) bool {
+	_, command := commandMap[name]
+	_, option := configFieldMap[name]
+	return command || option
+}
+
+// usage returns a summary of every command and option.
+func usage() string {
+	var b strings.Builder
+	b.WriteString("Commands:\n")
+	for _, c := range commands {
+		fmt.Fprintf(&b, "  %-10s %s\n", c.name, c.description)
+	}
+
+	b.WriteString("\nOptions:\n")
+	names := make([]string, 0, len(configFields))
+	for _, f := range configFields {
+		names = append(names, f.name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(&b, "  %-12s %s\n", name, configHelp[name])
+	}
+
+	b.WriteString(`
+Any other input is sent to the model as a prompt, including input
+starting with a command followed by words it does not take, like
+"show me how" or "history of rome". Start a prompt with ">file" or
+">>file" to write or append the reply to file.
+Options are set with <option>=<value>, and shown with "options".
+Type "help <command>" or "help <option>" for details.`)
+	return b.String()
+}
+
+// help returns the detailed help of c.
+func (c *command) help() string {
+	var b strings.Builder
+	b.WriteString(c.name)
+	if c.usage != "" {
+		b.WriteString(" " + c.usage)
+	}
+	fmt.Fprintf(&b, "\n  %s", c.description)
+	if len(c.aliases) > 0 {
+		fmt.Fprintf(&b, "\n  aliases: %s", strings.Join(c.aliases, ", "))
+	}
+	return b.String()
+}
+
+// help returns the detailed help of f.
+func (f configField) help() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s=<%s>\n  %s", f.name, f.typeName(), configHelp[f.name])
+	if len(f.choices) > 0 {
+		fmt.Fprintf(&b, "\n  choices: %s", strings.Join(f.choices, " | "))
+		fmt.Fprintf(&b, "\n  A choice can also be selected by its name alone, e.g. %q.", f.choices[0])
+	}
+	if k := f.constraint; k != nil {
+		reason := ""
+		if k.limit != nil {
+			reason = " depending on the model"
+		}
+		fmt.Fprintf(&b, "\n  values: %s", k.describe(k.max, reason))
+	}
+	def := f.defaultValue
+	switch {
+	case def == "":
+		def = `""`
+	case def == "0" && f.constraint != nil && f.constraint.unset:
+		def = "unset"
+	}
+	fmt.Fprintf(&b, "\n  default: %s", def)
+	if !f.saved {
+		b.WriteString("\n  not saved in settings")
+	}
+	return b.String()
+}
+
+// typeName returns the name of the type of values taken by f.
+func (f configField) typeName() string {
+	var c config
+	switch c.fieldPtr(f).(type) {
+	case *bool:
+		return "bool"
+	case *int:
+		return "int"
+	case *float64:
+		return "float"
+	}
+	return "string"
+}
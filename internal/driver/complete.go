@@ -0,0 +1,200 @@
+// MIT License
+//
+// Copyright (c) 2023 Kevin Herro
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+package driver
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// completionTimeout bounds the time spent fetching the model IDs to
+// complete, so that pressing tab does not hang without a connection.
+const completionTimeout = 5 * time.Second
+
+// complete returns the candidates completing the last word of line,
+// the text typed so far. Every candidate replaces that word whole.
+func (sh *shell) complete(line string) []string {
+	word := line[strings.LastIndexAny(line, " \t")+1:]
+	fields := strings.Fields(line[:len(line)-len(word)])
+
+	var candidates []string
+	switch {
+	case strings.HasPrefix(word, "@"):
+		candidates = completePath(word)
+	case len(fields) == 0 && strings.Contains(word, "="):
+		name, _, _ := strings.Cut(word, "=")
+		for _, v := range sh.values(name) {
+			candidates = append(candidates, name+"="+v)
+		}
+	case len(fields) == 0:
+		for name := range commandMap {
+			candidates = append(candidates, name)
+		}
+		for name := range configFieldMap {
+			if !isBoolConfig(name) {
+				name += "="
+			}
+			candidates = append(candidates, name)
+		}
+	case len(fields) > 0:
+		candidates = sh.arguments(fields[0], fields[1:])
+	}
+	return filterPrefix(candidates, word)
+}
+
+// values returns the values to complete for the config field name.
+func (sh *shell) values(name string) []string {
+	f, ok := configFieldMap[name]
+	if !ok || f.name != name {
+		return nil
+	}
+	switch {
+	case len(f.choices) > 0:
+		return f.choices
+	case isBoolConfig(name):
+		return []string{"true", "false"}
+	case name == "model":
+		return sh.modelIDs()
+	case name == "persona":
+		return personaNames()
+	}
+	return nil
+}
+
+// arguments returns the arguments to complete for the command named
+// cmd, following args.
+func (sh *shell) arguments(cmd string, args []string) []string {
+	c, ok := commandMap[cmd]
+	switch {
+	case !ok:
+		return nil
+	case c.name == "session":
+		return sessionArguments(args)
+	case len(args) > 0:
+		return nil
+	}
+	switch c.name {
+	case "help":
+		var names []string
+		for name := range commandMap {
+			names = append(names, name)
+		}
+		for _, f := range configFields {
+			names = append(names, f.name)
+		}
+		return names
+	case "model":
+		return sh.modelIDs()
+	case "persona":
+		return append(personaNames(), "none")
+	case "profile":
+		names := []string{"new", "copy", "delete", defaultProfile}
+		updateSettings(func(s *settings) (bool, error) {
+			for name := range s.Profiles {
+				names = append(names, name)
+			}
+			return false, nil
+		})
+		return names
+	case "usage":
+		return []string{"reset"}
+	case "edit":
+		return []string{"last"}
+	}
+	return nil
+}
+
+// sessionArguments returns the arguments of the session command to
+// complete following args: a subcommand, then the ID of a session.
+func sessionArguments(args []string) []string {
+	switch {
+	case len(args) == 0:
+		return []string{"resume", "rename", "delete"}
+	case len(args) > 1 || !isSessionSubcommand(args[0]):
+		return nil
+	}
+	sessions, _ := listSessions()
+	var ids []string
+	for _, s := range sessions {
+		ids = append(ids, s.ID)
+	}
+	return ids
+}
+
+// modelIDs returns the IDs of the available models, or none if they
+// cannot be listed.
+func (sh *shell) modelIDs() []string {
+	ctx, cancel := context.WithTimeout(context.Background(), completionTimeout)
+	defer cancel()
+	list, err := availableModels(ctx, sh.o)
+	if err != nil {
+		return nil
+	}
+	var ids []string
+	for _, m := range list {
+		ids = append(ids, m.ID)
+	}
+	return ids
+}
+
+// personaNames returns the names of the available personas.
+func personaNames() []string {
+	all, _ := personas()
+	var names []string
+	for name := range all {
+		names = append(names, name)
+	}
+	return names
+}
+
+// completePath returns the paths completing word, a path preceded
+// by "@". Directories are followed by a slash.
+func completePath(word string) []string {
+	path := word[1:]
+	dir, base := filepath.Split(path)
+	entries, err := os.ReadDir(filepath.Join(".", dir))
+	if err != nil {
+		return nil
+	}
+	var paths []string
+	for _, e := range entries {
+		name := e.Name()
+		if strings.HasPrefix(name, ".") && !strings.HasPrefix(base, ".") {
+			continue
+		}
+		p := "@" + dir + name
+		if e.IsDir() {
+			p += "/"
+		}
+		paths = append(paths, p)
+	}
+	return paths
+}
+
+// filterPrefix returns the sorted, unique candidates starting with prefix.
+func filterPrefix(candidates []string, prefix string) []string {
+	sort.Strings(candidates)
+	var matches []string
+	for i, c := range candidates {
+		if strings.HasPrefix(c, prefix) && (i == 0 || c != candidates[i-1]) {
+			matches = append(matches, c)
+		}
+	}
+	return matches
+}
@@ -28,12 +28,43 @@ import (
 // encoding and as a named variable.
 type config struct {
 	// Filename for file-based output formats, stdout by default.
-	Output string `json:"-"`
+	Output     string `json:"-"`
+	OutputMode string `json:"output_mode,omitempty"` // Whether to overwrite or append to Output.
+	Format     string `json:"format,omitempty"`      // How replies shown on a terminal are rendered.
 
 	// OpenAI API options.
+	Model       string  `json:"model,omitempty"`       // ID of the model to use.
 	Endpoint    string  `json:"endpoint,omitempty"`    // The OpenAI endpoint to use.
 	MaxTokens   int     `json:"max_tokens,omitempty"`  // The maximum number of tokens to generate in the completion.
 	Temperature float64 `json:"temperature,omitempty"` // What sampling temperature to use, between 0 and 2.
+	Stream      bool    `json:"stream,omitempty"`      // Show replies as they are generated.
+	System      string  `json:"system,omitempty"`      // The system message of chat conversations.
+	Persona     string  `json:"persona,omitempty"`     // The name of a preset system message.
+
+	// Sampling options. Zero values are not sent, leaving the API defaults.
+	TopP             float64 `json:"top_p,omitempty"`             // Nucleus sampling probability mass.
+	N                int     `json:"n,omitempty"`                 // How many choices to generate.
+	Stop             string  `json:"stop,omitempty"`              // Comma-separated stop sequences.
+	PresencePenalty  float64 `json:"presence_penalty,omitempty"`  // Penalty for tokens already used.
+	FrequencyPenalty float64 `json:"frequency_penalty,omitempty"` // Penalty for frequent tokens.
+	Seed             int     `json:"seed,omitempty"`              // Seed for deterministic sampling.
+	LogitBias        string  `json:"logit_bias,omitempty"`        // Comma-separated token:bias pairs.
+	User             string  `json:"user,omitempty"`              // ID of the end user.
+	ResponseFormat   string  `json:"response_format,omitempty"`   // The format of chat replies.
+
+	// Retry options.
+	MaxRetries   int     `json:"max_retries,omitempty"`    // How many times to retry a failed request.
+	MaxRetryWait float64 `json:"max_retry_wait,omitempty"` // The longest wait before a retry, in seconds.
+
+	// Usage options.
+	ShowUsage bool    `json:"show_usage,omitempty"` // Show the tokens used by every request.
+	Budget    float64 `json:"budget,omitempty"`     // The most a session may spend, in USD.
+
+	// Input options.
+	History   bool `json:"history,omitempty"`   // Record input in the history file.
+	Multiline bool `json:"multiline,omitempty"` // Read prompts until an empty line.
+
+	AttachLimit int `json:"attach_limit,omitempty"` // The most KiB of files attached to a prompt.
 }
 
 // fieldPtr returns a pointer to the field identified by f in c.
@@ -58,6 +89,11 @@ func (c *config) get(f configField) string {
 
 // set sets the value of field f in c to value.
 func (c *config) set(f configField, value string) error {
+	if f.validate != nil {
+		if err := f.validate(value); err != nil {
+			return fmt.Errorf("invalid %q value %q: %v", f.name, value, err)
+		}
+	}
 	switch ptr := c.fieldPtr(f).(type) {
 	case *string:
 		if len(f.choices) > 0 {
@@ -72,7 +108,7 @@ func (c *config) set(f configField, value string) error {
 		}
 		*ptr = value
 	case *bool:
-		v, err := strconv.ParseBool(value)
+		v, err := parseBool(value)
 		if err != nil {
 			return err
 		}
@@ -95,13 +131,35 @@ func (c *config) set(f configField, value string) error {
 	return nil
 }
 
+// parseBool parses the value of a boolean config field. Besides the
+// values accepted by strconv.ParseBool, it accepts "on" and "off".
+func parseBool(value string) (bool, error) {
+	switch value {
+	case "on":
+		return true, nil
+	case "off":
+		return false, nil
+	}
+	return strconv.ParseBool(value)
+}
+
 // defaultConfig returns the default configuration values.
 // It is not affected by flags and interactive assignments.
 func defaultConfig() config {
 	return config{
+		OutputMode:  "overwrite",
+		Format:      "raw",
+		Model:       "gpt-4o",
 		Endpoint:    "chat",
-		MaxTokens:   math.MaxInt32,
 		Temperature: 1,
+
+		ResponseFormat: "text",
+
+		History:     true,
+		AttachLimit: 256,
+
+		MaxRetries:   4,
+		MaxRetryWait: 60,
 	}
 }
 
@@ -137,15 +195,103 @@ func configure(name, value string) error {
 	if !ok {
 		return fmt.Errorf("unknown config field %q", name)
 	}
-	if f.name == name {
-		return currentCfg.set(f, value)
+	if f.name != name {
+		// name must be one of the choices. If value is true,
+		// set field-value to name.
+		if v, err := strconv.ParseBool(value); !v || err != nil {
+			return fmt.Errorf("unknown config field %q", name)
+		}
+		value = name
+	}
+	cfg := currentCfg
+	if err := cfg.set(f, value); err != nil {
+		return err
+	}
+	if err := cfg.checkAfterSet(f); err != nil {
+		return err
+	}
+	currentCfg = cfg
+	return nil
+}
+
+// constraint restricts the values of a numeric config field.
+type constraint struct {
+	min, max float64 // Inclusive bounds.
+	unset    bool    // Whether zero is also allowed, leaving the field unset.
+
+	// limit, if set, returns a tighter upper bound for the field
+	// depending on the rest of the config, and what it depends on.
+	limit func(c config) (max float64, reason string, ok bool)
+}
+
+// check returns an error if the value of field f in c, v, is out of bounds.
+func (k *constraint) check(f configField, c config, v float64) error {
+	if k.unset && v == 0 {
+		return nil
+	}
+	max, reason := k.max, ""
+	if k.limit != nil {
+		if l, r, ok := k.limit(c); ok && l < max {
+			max, reason = l, " for "+r
+		}
+	}
+	if v >= k.min && v <= max {
+		return nil
+	}
+	return fmt.Errorf("%s must be %s, not %g", f.name, k.describe(max, reason), v)
+}
+
+// describe describes the values allowed by k, with max as upper bound
+// for the given reason.
+func (k *constraint) describe(max float64, reason string) string {
+	var s string
+	switch {
+	case math.IsInf(max, 1):
+		s = fmt.Sprintf("at least %g", k.min)
+	case math.IsInf(k.min, -1):
+		s = fmt.Sprintf("at most %g", max)
+	default:
+		s = fmt.Sprintf("between %g and %g", k.min, max)
+	}
+	s += reason
+	if k.unset {
+		s += ", or 0 to leave it unset"
 	}
-	// name must be one of the choices. If value is true,
-	// set field-value to name.
-	if v, err := strconv.ParseBool(value); v && err == nil {
-		return currentCfg.set(f, name)
+	return s
+}
+
+// checkField returns an error if the value of field f in c breaks
+// its constraint.
+func (c config) checkField(f configField) error {
+	if f.constraint == nil {
+		return nil
 	}
-	return fmt.Errorf("unknown config field %q", name)
+	var v float64
+	switch ptr := c.fieldPtr(f).(type) {
+	case *int:
+		v = float64(*ptr)
+	case *float64:
+		v = *ptr
+	default:
+		return nil
+	}
+	return f.constraint.check(f, c, v)
+}
+
+// checkAfterSet returns an error if the value of field f in c, just
+// set, breaks its constraint or the constraints of fields depending on it.
+func (c config) checkAfterSet(f configField) error {
+	if err := c.checkField(f); err != nil {
+		return err
+	}
+	for _, g := range configFields {
+		if g.name != f.name && g.constraint != nil && g.constraint.limit != nil {
+			if err := c.checkField(g); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
 }
 
 // currentCfg holds the current configuration values.
@@ -159,6 +305,12 @@ func currentConfig() config {
 	return currentCfg
 }
 
+func setCurrentConfig(cfg config) {
+	currentCfgMu.Lock()
+	defer currentCfgMu.Unlock()
+	currentCfg = cfg
+}
+
 // configField contains metadata for a single configuration field.
 type configField struct {
 	name         string              // JSON field name/key in variables.
@@ -167,6 +319,8 @@ type configField struct {
 	field        reflect.StructField // Field in config.
 	choices      []string            // Name of variables in group.
 	defaultValue string              // Default value for this field.
+	validate     func(string) error  // Checks values, if set.
+	constraint   *constraint         // Restricts numeric values, if set.
 }
 
 var (
@@ -180,21 +334,70 @@ var (
 func init() {
 	// Config names for fields that are NOT saved in settings and
 	// therefore do NOT have a JSON name.
-	notSaved := map[string]string{}
+	notSaved := map[string]string{
+		"Output": "output",
+	}
 
 	// choices holds the list of allowed values for config fields that
 	// can take on one of a bounded set of values.
 	choices := map[string][]string{
-		"endpoint": {"chat", "completions", "models"},
+		"output_mode": {"overwrite", "append"},
+		"format":      {"raw", "markdown"},
+		"endpoint":    {"chat", "completions"},
+
+		"response_format": {"text", "json_object"},
+	}
+
+	// validators holds functions checking the values of config fields
+	// whose syntax is not checked by their type.
+	validators := map[string]func(string) error{
+		"stop": func(v string) error {
+			_, err := parseStop(v)
+			return err
+		},
+		"logit_bias": func(v string) error {
+			_, err := parseLogitBias(v)
+			return err
+		},
+	}
+
+	// constraints holds the bounds of numeric config fields.
+	inf := math.Inf(1)
+	constraints := map[string]*constraint{
+		"max_tokens": {min: 1, max: inf, unset: true, limit: func(c config) (float64, string, bool) {
+			max, ok := maxOutputTokens(c.Model)
+			return float64(max), "model " + c.Model, ok
+		}},
+		"temperature":       {min: 0, max: 2},
+		"top_p":             {min: 0, max: 1},
+		"n":                 {min: 1, max: 128, unset: true},
+		"presence_penalty":  {min: -2, max: 2},
+		"frequency_penalty": {min: -2, max: 2},
+		"max_retries":       {min: 0, max: 100},
+		"max_retry_wait":    {min: 0, max: inf},
+		"budget":            {min: 0, max: inf},
+		"attach_limit":      {min: 1, max: inf},
 	}
 
 	// urlParam holds the mapping from a config field name to the URL
 	// parameter used to hold that config field. If no entry is present
 	// for a name, the corresponding field is not saved in URLs.
 	urlParam := map[string]string{
+		"model":       "model",
 		"endpoint":    "endpoint",
 		"max_tokens":  "maxtokens",
 		"temperature": "temp",
+		"stream":      "stream",
+
+		"top_p":             "topp",
+		"n":                 "n",
+		"stop":              "stop",
+		"presence_penalty":  "presencepenalty",
+		"frequency_penalty": "frequencypenalty",
+		"seed":              "seed",
+		"logit_bias":        "logitbias",
+		"user":              "user",
+		"response_format":   "responseformat",
 	}
 
 	d := defaultConfig()
@@ -216,11 +419,13 @@ func init() {
 			}
 		}
 		f := configField{
-			name:     name,
-			urlParam: urlParam[name],
-			saved:    name == json[0],
-			field:    field,
-			choices:  choices[name],
+			name:       name,
+			urlParam:   urlParam[name],
+			saved:      name == json[0],
+			field:      field,
+			choices:    choices[name],
+			validate:   validators[name],
+			constraint: constraints[name],
 		}
 		f.defaultValue = d.get(f)
 		configFields = append(configFields, f)
@@ -0,0 +1,56 @@
+// MIT License
+//
+// Copyright (c) 2023 Kevin Herro
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+package driver
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestConfigureConstraints(t *testing.T) {
+	t.Cleanup(func() { setCurrentConfig(defaultConfig()) })
+	for _, tc := range []struct {
+		assignments []string // name=value
+		err         string   // Error of the last one.
+	}{
+		{assignments: []string{"temperature=2"}},
+		{assignments: []string{"temperature=-40"}, err: "temperature must be between 0 and 2, not -40"},
+		{assignments: []string{"max_tokens=0"}},
+		{assignments: []string{"max_tokens=-1"}, err: "max_tokens must be between 1 and 16384 for model gpt-4o, or 0 to leave it unset, not -1"},
+		{assignments: []string{"max_tokens=1.5"}, err: `invalid syntax`},
+		{assignments: []string{"model=custom", "max_tokens=1000000"}},
+		{assignments: []string{"max_tokens=9000", "model=gpt-3.5-turbo-instruct"}, err: "max_tokens must be between 1 and 4096 for model gpt-3.5-turbo-instruct"},
+		{assignments: []string{"max_retry_wait=-1"}, err: "max_retry_wait must be at least 0, not -1"},
+	} {
+		setCurrentConfig(defaultConfig())
+		var err error
+		for _, a := range tc.assignments {
+			name, value, _ := strings.Cut(a, "=")
+			if err = configure(name, value); err != nil {
+				break
+			}
+		}
+		switch {
+		case tc.err == "" && err != nil:
+			t.Errorf("%v: %v", tc.assignments, err)
+		case tc.err != "" && (err == nil || !strings.Contains(err.Error(), tc.err)):
+			t.Errorf("%v: got error %v, want %q", tc.assignments, err, tc.err)
+		}
+	}
+	// Failed assignments leave the config unchanged.
+	if got := currentConfig().Model; got != "gpt-4o" {
+		t.Errorf("model is %q after a failed assignment, want gpt-4o", got)
+	}
+}
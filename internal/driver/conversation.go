@@ -0,0 +1,82 @@
+// MIT License
+//
+// Copyright (c) 2023 Kevin Herro
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+package driver
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/kevherro/vyx/internal/api/chat"
+)
+
+// conversation holds the messages exchanged with the model so far.
+// It is sent in full with every chat request so that follow-up
+// questions have the context of earlier turns.
+type conversation struct {
+	messages []chat.Message
+}
+
+// with returns the messages of the conversation followed by a new
+// user message holding prompt. The conversation itself is not modified.
+func (c *conversation) with(prompt string) []chat.Message {
+	msgs := make([]chat.Message, 0, len(c.messages)+1)
+	msgs = append(msgs, c.messages...)
+	return append(msgs, chat.Message{Role: chat.RoleUser, Content: prompt})
+}
+
+// add appends a message with the given role and content.
+func (c *conversation) add(role, content string) {
+	c.messages = append(c.messages, chat.Message{Role: role, Content: content})
+}
+
+// clear forgets all messages.
+func (c *conversation) clear() {
+	c.messages = nil
+}
+
+// dropLast removes the last turn: the last user message and every
+// message that follows it. It returns false if there is nothing to drop.
+func (c *conversation) dropLast() bool {
+	for i := len(c.messages) - 1; i >= 0; i-- {
+		if c.messages[i].Role == chat.RoleUser {
+			c.messages = c.messages[:i]
+			return true
+		}
+	}
+	return false
+}
+
+// lastPrompt returns the content of the last user message, and
+// false if there is none.
+func (c *conversation) lastPrompt() (string, bool) {
+	for i := len(c.messages) - 1; i >= 0; i-- {
+		if c.messages[i].Role == chat.RoleUser {
+			return c.messages[i].Content, true
+		}
+	}
+	return "", false
+}
+
+// String formats the conversation for display, one message per paragraph.
+func (c *conversation) String() string {
+	var b strings.Builder
+	for i, m := range c.messages {
+		if i > 0 {
+			b.WriteString("\n")
+		}
+		fmt.Fprintf(&b, "[%s]\n%s\n", m.Role, m.Content)
+	}
+	return b.String()
+}
@@ -15,9 +15,20 @@
 // Package driver implements the core vyx functionality.
 package driver
 
-import "github.com/kevherro/vyx/internal/plugin"
+import (
+	"github.com/kevherro/vyx/internal/plugin"
+)
 
 func Vyx(eo *plugin.Options) error {
 	o := setDefaults(eo)
-	return interactive(o)
+
+	// Settings are applied in order of precedence: the settings file,
+	// then the environment, then flags and interactive assignments.
+	if err := loadSettings(); err != nil {
+		o.UI.PrintErr(err)
+	}
+	if err := configureFromEnv(); err != nil {
+		return &usageError{err}
+	}
+	return cli(o)
 }
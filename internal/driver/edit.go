@@ -0,0 +1,137 @@
+// MIT License
+//
+// Copyright (c) 2023 Kevin Herro
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+package driver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/kevherro/vyx/internal/api/chat"
+)
+
+// editTemplate follows the text of prompts opened in the editor.
+// Its lines start with commentStart, and are dropped with every
+// other line that does.
+var editTemplate = commentStart + " Write the prompt above, then save and quit to send it.\n" +
+	commentStart + " Lines starting with " + commentStart + " are ignored. An empty prompt is not sent.\n"
+
+// editor returns the command that runs the user's editor.
+func editor() string {
+	for _, env := range []string{"VISUAL", "EDITOR"} {
+		if e := strings.TrimSpace(os.Getenv(env)); e != "" {
+			return e
+		}
+	}
+	return "vi"
+}
+
+// editText opens the editor on a temporary file holding text and
+// returns the contents of the file once the editor exits, less the
+// lines starting with commentStart.
+func editText(text string) (string, error) {
+	f, err := os.CreateTemp("", "vyx-*.md")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(f.Name())
+	if text != "" && !strings.HasSuffix(text, "\n") {
+		text += "\n"
+	}
+	_, err = f.WriteString(text + "\n" + editTemplate)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return "", err
+	}
+
+	// The editor is run by the shell, as it may come with arguments.
+	cmd := exec.Command("sh", "-c", editor()+` "$@"`, "vyx-editor", f.Name())
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("editor %q failed: %v", editor(), err)
+	}
+	data, err := os.ReadFile(f.Name())
+	if err != nil {
+		return "", err
+	}
+	var lines []string
+	for _, line := range strings.Split(string(data), "\n") {
+		if !strings.HasPrefix(line, commentStart) {
+			lines = append(lines, line)
+		}
+	}
+	return strings.TrimSpace(strings.Join(lines, "\n")), nil
+}
+
+// edit implements the edit command. It opens the editor on the text
+// in args, or else on the last prompt, and sends the result as the
+// next prompt. With "last", the result replaces the last prompt of the
+// conversation, and its reply is generated again.
+func (sh *shell) edit(ctx context.Context, args []string) error {
+	if len(args) == 1 && args[0] == "last" {
+		return sh.editLast(ctx)
+	}
+	text := strings.Join(args, " ")
+	if text == "" {
+		text = sh.lastPrompt
+	}
+	prompt, err := editText(text)
+	if err != nil {
+		return err
+	}
+	if prompt == "" {
+		return errors.New("prompt is empty, nothing sent")
+	}
+	sh.o.UI.Print(prompt)
+	return sh.askPrompt(ctx, prompt, outputFor(currentConfig()))
+}
+
+// editLast opens the editor on the last prompt of the conversation,
+// and replaces that turn with the result and a new reply.
+func (sh *shell) editLast(ctx context.Context) error {
+	text, inConv := sh.conv.lastPrompt()
+	if !inConv {
+		// Prompts sent to the completions endpoint are not kept.
+		text = sh.lastPrompt
+	}
+	if text == "" {
+		return errors.New("no prompt to edit")
+	}
+	prompt, err := editText(text)
+	if err != nil {
+		return err
+	}
+	if prompt == "" {
+		return errors.New("prompt is empty, nothing sent")
+	}
+	sh.o.UI.Print(prompt)
+
+	// dropLast reuses the array of the messages, copy them first.
+	messages := append([]chat.Message(nil), sh.conv.messages...)
+	if inConv {
+		sh.conv.dropLast()
+	}
+	if err := sh.askPrompt(ctx, prompt, outputFor(currentConfig())); err != nil {
+		// Keep the turn that was to be replaced.
+		sh.conv.messages = messages
+		return err
+	}
+	return nil
+}
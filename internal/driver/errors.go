@@ -0,0 +1,145 @@
+// MIT License
+//
+// Copyright (c) 2023 Kevin Herro
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+package driver
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// errorKind classifies the errors reported by the API.
+type errorKind int
+
+const (
+	errOther          errorKind = iota
+	errAuth                     // The API key is missing, invalid or lacks permissions.
+	errRateLimit                // Too many requests, or the quota is exhausted.
+	errInvalidRequest           // The request was rejected as malformed.
+	errContextLength            // The prompt does not fit the context window.
+	errServer                   // The server failed to process a valid request.
+)
+
+// apiErrorBody is the error object the API returns in place of a result.
+type apiErrorBody struct {
+	Message string `json:"message"`
+	Type    string `json:"type"`
+	Param   string `json:"param"`
+	Code    any    `json:"code"` // A string or a number, if set.
+}
+
+// apiError is an error reported by the API.
+type apiError struct {
+	kind       errorKind
+	statusCode int    // HTTP status code, 0 for errors sent within a stream.
+	errType    string // API error type, e.g. invalid_request_error.
+	code       string // API error code, e.g. context_length_exceeded.
+	message    string
+	requestID  string // ID of the request, for reports to OpenAI.
+
+	retryAfter  time.Duration // How long the server asks to wait before a retry.
+	shouldRetry string        // Whether the server says to retry, if it does.
+}
+
+// newAPIError returns the error described by body, which was returned
+// with the given HTTP status code and headers.
+func newAPIError(statusCode int, header http.Header, body *apiErrorBody) *apiError {
+	e := &apiError{
+		statusCode: statusCode,
+		errType:    body.Type,
+		message:    body.Message,
+		requestID:  header.Get("X-Request-Id"),
+	}
+	if body.Code != nil {
+		e.code = fmt.Sprint(body.Code)
+	}
+	if e.message == "" {
+		e.message = http.StatusText(statusCode)
+	}
+
+	switch {
+	case e.code == "context_length_exceeded" || strings.Contains(e.message, "maximum context length"):
+		e.kind = errContextLength
+	case statusCode == http.StatusUnauthorized || statusCode == http.StatusForbidden,
+		e.errType == "authentication_error", e.code == "invalid_api_key":
+		e.kind = errAuth
+	case statusCode == http.StatusTooManyRequests, e.errType == "rate_limit_error",
+		e.code == "rate_limit_exceeded", e.code == "insufficient_quota":
+		e.kind = errRateLimit
+	case statusCode >= 500, e.errType == "server_error":
+		e.kind = errServer
+	case statusCode >= 400, e.errType == "invalid_request_error":
+		e.kind = errInvalidRequest
+	}
+	e.retryAfter = parseRetryAfter(header, e.kind == errRateLimit)
+	e.shouldRetry = header.Get("X-Should-Retry")
+	return e
+}
+
+// responseError returns the error described by the body of a response
+// with a non-2xx status code.
+func responseError(resp *http.Response, body []byte) *apiError {
+	var envelope struct {
+		Error *apiErrorBody `json:"error"`
+	}
+	if json.Unmarshal(body, &envelope) != nil || envelope.Error == nil {
+		// Not an API error, maybe from a proxy. Keep some of it.
+		msg := strings.TrimSpace(string(body))
+		if len(msg) > 200 {
+			msg = msg[:200] + "..."
+		}
+		envelope.Error = &apiErrorBody{Message: msg}
+	}
+	return newAPIError(resp.StatusCode, resp.Header, envelope.Error)
+}
+
+func (e *apiError) Error() string {
+	var b strings.Builder
+	switch e.kind {
+	case errAuth:
+		b.WriteString("authentication failed: " + e.message)
+		if os.Getenv("OPENAI_API_KEY") == "" {
+			b.WriteString(" (OPENAI_API_KEY is not set)")
+		}
+	case errRateLimit:
+		b.WriteString("rate limited: " + e.message)
+	case errContextLength:
+		b.WriteString("the conversation is too long for the model: " + e.message +
+			` (type "drop" or "clear" to shorten it)`)
+	case errServer:
+		b.WriteString("server error: " + e.message)
+	case errInvalidRequest:
+		b.WriteString("invalid request: " + e.message)
+	default:
+		b.WriteString(e.message)
+	}
+	var details []string
+	if e.statusCode != 0 {
+		details = append(details, fmt.Sprintf("status %d", e.statusCode))
+	}
+	if e.errType != "" {
+		details = append(details, "type "+e.errType)
+	}
+	if e.requestID != "" {
+		details = append(details, "request ID "+e.requestID)
+	}
+	if len(details) > 0 {
+		fmt.Fprintf(&b, " [%s]", strings.Join(details, ", "))
+	}
+	return b.String()
+}
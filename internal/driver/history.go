@@ -0,0 +1,183 @@
+// MIT License
+//
+// Copyright (c) 2023 Kevin Herro
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+package driver
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/kevherro/vyx/internal/plugin"
+)
+
+const (
+	// historyLimit is the most entries kept in the history file.
+	historyLimit = 1000
+
+	// historyListed is how many entries the history command lists.
+	historyListed = 25
+)
+
+// history holds the input of interactive sessions, oldest first,
+// without duplicates. It is saved in a file, one JSON string per line
+// so that entries can span several lines.
+type history struct {
+	fname   string
+	entries []string
+}
+
+// historyFileName returns the name of the history file.
+func historyFileName() (string, error) {
+	dir, err := dataDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "history"), nil
+}
+
+// loadHistory reads the history file. A missing file holds no history.
+func loadHistory() (*history, error) {
+	fname, err := historyFileName()
+	if err != nil {
+		return nil, err
+	}
+	h := &history{fname: fname}
+	f, err := os.Open(fname)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return h, nil
+		}
+		return nil, fmt.Errorf("could not read history: %w", err)
+	}
+	defer f.Close()
+	s := bufio.NewScanner(f)
+	s.Buffer(nil, 1<<20)
+	for s.Scan() {
+		var entry string
+		if err := json.Unmarshal(s.Bytes(), &entry); err != nil {
+			return nil, fmt.Errorf("could not parse history in %s: %w", fname, err)
+		}
+		h.entries = append(h.entries, entry)
+	}
+	if err := s.Err(); err != nil {
+		return nil, fmt.Errorf("could not read history: %w", err)
+	}
+	return h, nil
+}
+
+// add records input at the end of the history, removing earlier
+// copies, and saves the history. Input starting with a space is not
+// recorded, so that sensitive prompts can be kept out of the history.
+func (h *history) add(input string) error {
+	input = strings.TrimRightFunc(input, unicode.IsSpace)
+	if input == "" || strings.HasPrefix(input, " ") {
+		return nil
+	}
+	entries := h.entries[:0]
+	for _, e := range h.entries {
+		if e != input {
+			entries = append(entries, e)
+		}
+	}
+	h.entries = append(entries, input)
+	if n := len(h.entries); n > historyLimit {
+		h.entries = h.entries[n-historyLimit:]
+	}
+	return h.save()
+}
+
+// save writes the history to its file, only readable by its owner.
+func (h *history) save() error {
+	var b strings.Builder
+	for _, e := range h.entries {
+		data, err := json.Marshal(e)
+		if err != nil {
+			return err
+		}
+		b.Write(data)
+		b.WriteByte('\n')
+	}
+	if err := os.MkdirAll(filepath.Dir(h.fname), 0700); err != nil {
+		return fmt.Errorf("failed to create data directory: %w", err)
+	}
+	if err := os.WriteFile(h.fname, []byte(b.String()), 0600); err != nil {
+		return fmt.Errorf("failed to write history: %w", err)
+	}
+	return nil
+}
+
+// recordHistory adds input to the history of sh, unless disabled by
+// the history config field, and passes the history on to the UI.
+func (sh *shell) recordHistory(input string) {
+	if sh.history == nil || !currentConfig().History {
+		return
+	}
+	if err := sh.history.add(input); err != nil {
+		sh.o.UI.PrintErr(err)
+	}
+	if u, ok := sh.o.UI.(plugin.HistoryUI); ok {
+		u.SetHistory(sh.history.entries)
+	}
+}
+
+// isHistoryEntry returns true if arg is the number of a history entry.
+func isHistoryEntry(arg string) bool {
+	n, err := strconv.Atoi(arg)
+	return err == nil && n >= 1
+}
+
+// historyCommand runs the history command with the given arguments.
+// Without arguments, it lists the latest entries of the history. With
+// the number of an entry, it runs that entry again.
+func (sh *shell) historyCommand(args []string) (string, error) {
+	if sh.history == nil {
+		return "", errors.New("history is not available")
+	}
+	entries := sh.history.entries
+	switch len(args) {
+	case 0:
+		start := 0
+		if len(entries) > historyListed {
+			start = len(entries) - historyListed
+		}
+		var lines []string
+		for i := start; i < len(entries); i++ {
+			text := strings.ReplaceAll(entries[i], "\n", "\n      ")
+			lines = append(lines, fmt.Sprintf("%5d %s", i+1, text))
+		}
+		if len(lines) == 0 {
+			lines = append(lines, "history is empty")
+		}
+		sh.o.UI.Print(strings.Join(lines, "\n"))
+		return "", nil
+	case 1:
+		n, err := strconv.Atoi(args[0])
+		if err != nil || n < 1 || n > len(entries) {
+			return "", fmt.Errorf("no history entry %q", args[0])
+		}
+		entry := entries[n-1]
+		if f := strings.Fields(entry); len(f) > 0 && commandMap[f[0]] != nil && commandMap[f[0]].name == "history" {
+			return "", errors.New("history commands cannot be run again")
+		}
+		return entry, nil
+	}
+	return "", errors.New("usage: history [<n>]")
+}
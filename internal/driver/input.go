@@ -0,0 +1,126 @@
+// MIT License
+//
+// Copyright (c) 2023 Kevin Herro
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+package driver
+
+import (
+	"strings"
+
+	"github.com/kevherro/vyx/internal/plugin"
+)
+
+// continuationPrompt is shown when reading the lines that continue an input.
+const continuationPrompt = "... "
+
+// blockDelim opens and closes a prompt spanning several lines.
+const blockDelim = `"""`
+
+// readInput reads the next input from ui. An input spans several lines
+// if its lines end with a backslash, if it is enclosed in """ lines, or,
+// in multiline mode, until an empty line. Pasted text may also span
+// several lines. The lines are joined with newlines.
+func readInput(ui plugin.UI) (string, error) {
+	line, err := ui.ReadLine(prompt())
+	if err != nil {
+		return line, err
+	}
+	line = strings.TrimRight(line, "\r\n")
+
+	if rest, ok := strings.CutPrefix(strings.TrimSpace(line), blockDelim); ok {
+		return readBlock(ui, rest)
+	}
+	if strings.HasSuffix(line, `\`) {
+		return readContinued(ui, line)
+	}
+	if currentConfig().Multiline && line != "" && !isDirective(line) {
+		return readParagraph(ui, line)
+	}
+	return line, nil
+}
+
+// readBlock reads the lines of ui up to a line ending with """.
+// first is the rest of the line that opened the block.
+func readBlock(ui plugin.UI, first string) (string, error) {
+	var lines []string
+	line := first
+	for {
+		if line == "" && len(lines) == 0 {
+			// The block starts on the next line.
+			var err error
+			if line, err = readContinuation(ui); err != nil {
+				return "", err
+			}
+			continue
+		}
+		if text, ok := strings.CutSuffix(strings.TrimRight(line, " \t"), blockDelim); ok {
+			if strings.TrimSpace(text) != "" {
+				lines = append(lines, text)
+			}
+			return strings.Join(lines, "\n"), nil
+		}
+		lines = append(lines, line)
+		next, err := readContinuation(ui)
+		if err != nil {
+			return strings.Join(lines, "\n"), err
+		}
+		line = next
+	}
+}
+
+// readContinued reads the lines of ui for as long as they end with a
+// backslash, starting with first. The backslashes are dropped.
+func readContinued(ui plugin.UI, first string) (string, error) {
+	var lines []string
+	line := first
+	for strings.HasSuffix(line, `\`) {
+		lines = append(lines, strings.TrimSuffix(line, `\`))
+		next, err := readContinuation(ui)
+		if err != nil {
+			return strings.Join(lines, "\n"), err
+		}
+		line = next
+	}
+	return strings.Join(append(lines, line), "\n"), nil
+}
+
+// readParagraph reads the lines of ui up to an empty line, starting
+// with first.
+func readParagraph(ui plugin.UI, first string) (string, error) {
+	lines := []string{first}
+	for {
+		line, err := readContinuation(ui)
+		if err != nil || line == "" {
+			return strings.Join(lines, "\n"), err
+		}
+		lines = append(lines, line)
+	}
+}
+
+// readContinuation reads a line continuing an input from ui.
+func readContinuation(ui plugin.UI) (string, error) {
+	line, err := ui.ReadLine(continuationPrompt)
+	return strings.TrimRight(line, "\r\n"), err
+}
+
+// isDirective returns true if line holds a command or an assignment
+// rather than the start of a prompt. Those are run as soon as they are
+// entered in multiline mode.
+func isDirective(line string) bool {
+	s := strings.SplitN(line, "=", 2)
+	if isConfigurable(strings.TrimSpace(s[0])) {
+		return true
+	}
+	_, _, ok := lookupCommand(line)
+	return ok
+}
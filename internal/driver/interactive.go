@@ -15,8 +15,11 @@
 package driver
 
 import (
+	"context"
 	"fmt"
 	"io"
+	"os"
+	"os/signal"
 	"sort"
 	"strings"
 
@@ -28,8 +31,20 @@ var commentStart = "//:" // Sentinel for comments on options.
 func interactive(o *plugin.Options) error {
 	// Enter the command processing loop.
 	greetings(o.UI)
+	sh := &shell{o: o, conv: &conversation{}}
+	if c, ok := o.UI.(plugin.CompletingUI); ok {
+		c.SetCompleter(sh.complete)
+	}
+	if h, err := loadHistory(); err != nil {
+		o.UI.PrintErr(err)
+	} else {
+		sh.history = h
+		if u, ok := o.UI.(plugin.HistoryUI); ok {
+			u.SetHistory(h.entries)
+		}
+	}
 	for {
-		input, err := o.UI.ReadLine("(vyx) ")
+		input, err := readInput(o.UI)
 		if err != nil {
 			if err != io.EOF {
 				return err
@@ -39,54 +54,105 @@ func interactive(o *plugin.Options) error {
 			}
 		}
 
-		// Process assignments of the form variable=value.
-		if s := strings.SplitN(input, "=", 2); len(s) > 0 {
-			name := strings.TrimSpace(s[0])
-			var value string
-			if len(s) == 2 {
-				value = s[1]
-				if comment := strings.LastIndex(value, commentStart); comment != -1 {
-					value = value[:comment]
-				}
-				value = strings.TrimSpace(value)
+		// Input is recorded once run, so that input turning the
+		// history off, as "history=off", is not.
+		recording := currentConfig().History
+
+		// Ctrl-C cancels the command rather than ending the session.
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+		err = sh.execute(ctx, input)
+		stop()
+		if recording {
+			sh.recordHistory(input)
+		}
+		if err == errExit {
+			return nil
+		}
+	}
+}
+
+// execute runs the command, assignment or prompt in input, reporting
+// errors on the UI. It returns errExit if the session should end.
+func (sh *shell) execute(ctx context.Context, input string) error {
+	o := sh.o
+
+	// Process assignments of the form variable=value. Bare names
+	// of commands are not assignments, even if they name an option.
+	if s := strings.SplitN(input, "=", 2); len(s) == 2 || !isCommand(s[0]) {
+		name := strings.TrimSpace(s[0])
+		var value string
+		if len(s) == 2 {
+			value = s[1]
+			if comment := strings.LastIndex(value, commentStart); comment != -1 {
+				value = value[:comment]
 			}
-			if isConfigurable(name) {
-				// All non-bool options require inputs.
-				if len(s) == 1 && !isBoolConfig(name) {
+			value = strings.TrimSpace(value)
+		}
+		if isConfigurable(name) {
+			// All non-bool options require inputs.
+			if len(s) == 1 {
+				if !isBoolConfig(name) {
 					o.UI.PrintErr(fmt.Errorf("please specify a value, e.g. %s=<val>", name))
-					continue
+					return nil
 				}
-				if err := configure(name, value); err != nil {
+				value = "true"
+			}
+			if configFieldMap[name].name == "model" {
+				if err := checkModel(ctx, value, o); err != nil {
 					o.UI.PrintErr(err)
+					return nil
 				}
-				continue
 			}
+			if err := configure(name, value); err != nil {
+				o.UI.PrintErr(err)
+			}
+			return nil
 		}
+	}
 
-		tokens := strings.Fields(input)
-		if len(tokens) == 0 {
-			continue
-		}
+	if strings.TrimSpace(input) == "" {
+		return nil
+	}
 
-		switch tokens[0] {
-		case "o", "options":
-			printCurrentOptions(o.UI)
-			continue
-		case "help":
-			commandHelp(strings.Join(tokens[1:], " "), o.UI)
-			continue
-		case "exit", "quit", "q":
+	if c, args, ok := lookupCommand(input); ok {
+		err := c.run(ctx, sh, args)
+		if err != nil && err != errExit {
+			o.UI.PrintErr(err)
 			return nil
 		}
+		return err
+	}
 
-		reply, err := parseTokens(tokens)
-		if err == nil {
-			o.UI.Print(strings.Join(reply, " "))
-		}
-		if err != nil {
-			o.UI.PrintErr(err)
-		}
+	text, out := parseRedirect(strings.TrimSpace(input))
+	if out == nil {
+		out = outputFor(currentConfig())
+	}
+	if err := sh.askPrompt(ctx, text, out); err != nil {
+		o.UI.PrintErr(err)
+	}
+	return nil
+}
+
+// askPrompt sends prompt, with the files it references attached, and
+// writes the reply to out, then saves the session.
+func (sh *shell) askPrompt(ctx context.Context, prompt string, out *output) error {
+	sh.lastPrompt = prompt
+	cfg := currentConfig()
+	text, atts, err := attach(prompt, cfg.AttachLimit*1024)
+	if err != nil {
+		return err
+	}
+	if err := checkContext(cfg, sh.conv, text, atts); err != nil {
+		return err
+	}
+	reportAttachments(sh.o.UI, atts)
+	if err := askTo(ctx, sh.o, sh.conv, text, out, nil); err != nil {
+		return err
 	}
+	if err := sh.saveSession(); err != nil {
+		sh.o.UI.PrintErr("could not save session: ", err)
+	}
+	return nil
 }
 
 func greetings(ui plugin.UI) {
@@ -107,8 +173,8 @@ func printCurrentOptions(ui plugin.UI) {
 			comment = "[" + strings.Join(values, " | ") + "]"
 		case n == "temperature" && v == "1":
 			comment = "default"
-		case n == "max_tokens" && v == "2147483647":
-			comment = "default"
+		case f.constraint != nil && f.constraint.unset && v == "0":
+			comment = "unset"
 		case v == "":
 			// Add quotes for empty values.
 			v = `""`
@@ -122,6 +188,24 @@ func printCurrentOptions(ui plugin.UI) {
 	ui.Print(strings.Join(args, "\n"))
 }
 
-func commandHelp(args string, ui plugin.UI) {
-	ui.Print(args)
+// lookupCommand returns the command input runs and its arguments, or
+// false if input is not a command. Input starting with the name of a
+// command but followed by words the command does not take is a prompt,
+// as in "show me how" or "history of rome".
+func lookupCommand(input string) (*command, []string, bool) {
+	tokens := strings.Fields(input)
+	if len(tokens) == 0 {
+		return nil, nil, false
+	}
+	c, ok := commandMap[tokens[0]]
+	if !ok || !c.runs(tokens[1:]) {
+		return nil, nil, false
+	}
+	return c, tokens[1:], true
+}
+
+// isCommand returns true if input is the bare name of a command.
+func isCommand(input string) bool {
+	_, ok := commandMap[strings.TrimSpace(input)]
+	return ok
 }
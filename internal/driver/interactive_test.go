@@ -0,0 +1,705 @@
+// MIT License
+//
+// Copyright (c) 2023 Kevin Herro
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+package driver
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kevherro/vyx/internal/api/chat"
+	"github.com/kevherro/vyx/internal/apitest"
+	"github.com/kevherro/vyx/internal/plugin"
+)
+
+// testUI is a UI that reads scripted input and records what it shows.
+type testUI struct {
+	input   []string
+	out     strings.Builder // Messages and replies.
+	errs    strings.Builder // Error messages.
+	partial func()          // If set, called after showing partial messages.
+}
+
+func (ui *testUI) ReadLine(prompt string) (string, error) {
+	if len(ui.input) == 0 {
+		return "", io.EOF
+	}
+	line := ui.input[0]
+	ui.input = ui.input[1:]
+	return line, nil
+}
+
+func (ui *testUI) Print(args ...any) {
+	ui.out.WriteString(withNewline(fmt.Sprint(args...)))
+}
+
+func (ui *testUI) PrintPartial(args ...any) {
+	ui.out.WriteString(fmt.Sprint(args...))
+	if ui.partial != nil {
+		ui.partial()
+	}
+}
+
+func (ui *testUI) PrintErr(args ...any) {
+	ui.errs.WriteString(withNewline(fmt.Sprint(args...)))
+}
+
+func withNewline(s string) string {
+	if !strings.HasSuffix(s, "\n") {
+		s += "\n"
+	}
+	return s
+}
+
+// runInteractive runs an interactive session reading input, against
+// a fake server set up by script. It returns the fake and the UI.
+func runInteractive(t *testing.T, script func(*apitest.Server), input ...string) (*apitest.Server, *testUI) {
+	t.Helper()
+	srv, ui, o := setup(t, script, input...)
+	if err := interactive(o); err != nil {
+		t.Fatalf("interactive: %v", err)
+	}
+	return srv, ui
+}
+
+// setup returns options for a session reading input, against a fake
+// server set up by script, along with the fake and the UI.
+func setup(t *testing.T, script func(*apitest.Server), input ...string) (*apitest.Server, *testUI, *plugin.Options) {
+	t.Helper()
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	t.Setenv("XDG_DATA_HOME", t.TempDir())
+	t.Setenv("OPENAI_API_KEY", "test-key")
+	setCurrentProfile("", defaultConfig())
+	modelCache.models = nil
+	sessionUsage.reset()
+
+	srv := apitest.NewServer()
+	t.Cleanup(srv.Close)
+	srv.APIKey = "test-key"
+	if script != nil {
+		script(srv)
+	}
+
+	ui := &testUI{input: input}
+	o := setDefaults(&plugin.Options{UI: ui, HTTPClient: srv.Client(), BaseURL: srv.URL()})
+	return srv, ui, o
+}
+
+func TestConversation(t *testing.T) {
+	srv, ui := runInteractive(t, func(srv *apitest.Server) {
+		srv.Push(apitest.Reply{Text: "Go is a language."}, apitest.Reply{Text: "So is Rust."})
+	}, "what is go?", "and rust?", "drop", "show")
+
+	reqs := srv.Requests()
+	if len(reqs) != 2 {
+		t.Fatalf("got %d requests, want 2", len(reqs))
+	}
+	req, err := reqs[1].Chat()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, m := range req.Messages {
+		got = append(got, m.Role+": "+m.Content)
+	}
+	want := []string{"user: what is go?", "assistant: Go is a language.", "user: and rust?"}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("second request has messages\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+
+	out := ui.out.String()
+	for _, want := range []string{"Go is a language.\n", "So is Rust.\n", "[user]\nwhat is go?\n"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output does not contain %q:\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, "[user]\nand rust?") {
+		t.Errorf("dropped turn still shown:\n%s", out)
+	}
+	if ui.errs.Len() > 0 {
+		t.Errorf("unexpected errors:\n%s", ui.errs.String())
+	}
+}
+
+func TestStreaming(t *testing.T) {
+	reply := "Here:\n\n```go\nfunc main() {\n\tprintln(1)\n}\n```\n"
+	for _, endpoint := range []string{"chat", "completions"} {
+		t.Run(endpoint, func(t *testing.T) {
+			srv, ui := runInteractive(t, func(srv *apitest.Server) {
+				srv.Push(apitest.Reply{Text: reply})
+			}, "endpoint="+endpoint, "stream=true", "write a program")
+
+			if got := ui.out.String(); !strings.Contains(got, reply) {
+				t.Errorf("got output\n%s\nwant it to contain\n%s", got, reply)
+			}
+			if ui.errs.Len() > 0 {
+				t.Errorf("unexpected errors:\n%s", ui.errs.String())
+			}
+			req, _ := srv.LastRequest()
+			if !strings.Contains(string(req.Body), `"stream":true`) {
+				t.Errorf("request does not ask for a stream: %s", req.Body)
+			}
+		})
+	}
+}
+
+func TestErrors(t *testing.T) {
+	for _, tc := range []struct {
+		desc   string
+		stream bool
+		reply  apitest.Reply
+		want   string
+	}{
+		{
+			desc:  "auth",
+			reply: apitest.Reply{Status: http.StatusUnauthorized, ErrorType: "invalid_request_error", Message: "Incorrect API key provided."},
+			want:  "authentication failed: Incorrect API key provided. [status 401, type invalid_request_error, request ID req_1]",
+		},
+		{
+			desc:  "context length",
+			reply: apitest.Reply{Status: http.StatusBadRequest, ErrorCode: "context_length_exceeded", Message: "too many tokens"},
+			want:  "the conversation is too long for the model",
+		},
+		{
+			desc:  "invalid request",
+			reply: apitest.Reply{Status: http.StatusBadRequest, ErrorType: "invalid_request_error", Message: "bad temperature"},
+			want:  "invalid request: bad temperature",
+		},
+		{
+			desc:   "stream error",
+			stream: true,
+			reply:  apitest.Reply{Chunks: []string{"partial "}, StreamError: "overloaded"},
+			want:   "server error: overloaded",
+		},
+		{
+			desc:   "dropped stream",
+			stream: true,
+			reply:  apitest.Reply{Chunks: []string{"partial "}, Drop: true},
+			want:   "connection closed before the reply was complete",
+		},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			input := []string{fmt.Sprint("stream=", tc.stream), "max_retries=0", "hello", "show"}
+			_, ui := runInteractive(t, func(srv *apitest.Server) {
+				srv.Push(tc.reply)
+			}, input...)
+
+			if got := ui.errs.String(); !strings.Contains(got, tc.want) {
+				t.Errorf("got errors\n%s\nwant them to contain\n%s", got, tc.want)
+			}
+			if got := ui.out.String(); !strings.Contains(got, "conversation is empty") {
+				t.Errorf("failed request was added to the conversation:\n%s", got)
+			}
+		})
+	}
+}
+
+func TestInterrupt(t *testing.T) {
+	_, ui, o := setup(t, func(srv *apitest.Server) {
+		srv.Push(apitest.Reply{Chunks: []string{"one ", "two ", "three"}, ChunkLatency: 10 * time.Millisecond})
+	})
+	sh := &shell{o: o, conv: &conversation{}}
+	configure("stream", "true")
+
+	// Interrupt the request once the first chunk is shown.
+	ctx, cancel := context.WithCancel(context.Background())
+	ui.partial = cancel
+	if err := sh.execute(ctx, "count"); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := ui.errs.String(), "reply interrupted\n"; got != want {
+		t.Errorf("got errors %q, want %q", got, want)
+	}
+	if got := sh.conv.String(); !strings.Contains(got, "[assistant]\none \n") {
+		t.Errorf("partial reply not kept in the conversation:\n%s", got)
+	}
+
+	// Requests interrupted before any of the reply is received fail.
+	ui.errs.Reset()
+	if err := sh.execute(ctx, "count again"); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := ui.errs.String(), "request canceled\n"; got != want {
+		t.Errorf("got errors %q, want %q", got, want)
+	}
+}
+
+func TestRetry(t *testing.T) {
+	retry := apitest.Reply{
+		Status: http.StatusTooManyRequests,
+		Header: http.Header{"Retry-After-Ms": {"10"}},
+	}
+	srv, ui := runInteractive(t, func(srv *apitest.Server) {
+		srv.Push(retry, retry, apitest.Reply{Text: "finally"})
+	}, "hello")
+
+	if n := len(srv.Requests()); n != 3 {
+		t.Errorf("got %d requests, want 3", n)
+	}
+	if got, want := ui.errs.String(), "retrying in 1s (attempt 3/5)"; !strings.Contains(got, want) {
+		t.Errorf("got errors\n%s\nwant them to contain %q", got, want)
+	}
+	if got := ui.out.String(); !strings.Contains(got, "finally") {
+		t.Errorf("reply missing from output:\n%s", got)
+	}
+}
+
+func TestModels(t *testing.T) {
+	srv, ui := runInteractive(t, nil, "models mini", "model=nonexistent", "model=gpt-4o-mini", "model", "hello")
+
+	out := ui.out.String()
+	for _, want := range []string{"gpt-4o-mini\n", "id:       gpt-4o-mini\n"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output does not contain %q:\n%s", want, out)
+		}
+	}
+	if got, want := ui.errs.String(), `unknown model "nonexistent"`; !strings.Contains(got, want) {
+		t.Errorf("got errors\n%s\nwant them to contain %q", got, want)
+	}
+	req, _ := srv.LastRequest()
+	if !strings.Contains(string(req.Body), `"model":"gpt-4o-mini"`) {
+		t.Errorf("request does not use the chosen model: %s", req.Body)
+	}
+	if n := len(srv.Requests()); n != 2 {
+		t.Errorf("got %d requests, want the models to be listed once", n)
+	}
+
+	_, ui = runInteractive(t, func(srv *apitest.Server) {
+		srv.Models = nil
+	}, "models")
+	if got, want := ui.errs.String(), "the models list is empty or could not be read\n"; got != want {
+		t.Errorf("got errors %q for an empty models list, want %q", got, want)
+	}
+}
+
+func TestRedirect(t *testing.T) {
+	out := filepath.Join(t.TempDir(), "answer.md")
+	_, ui := runInteractive(t, func(srv *apitest.Server) {
+		srv.Push(apitest.Reply{Text: "one"}, apitest.Reply{Text: "two"})
+	}, ">"+out+" first", ">>"+out+" second")
+
+	got, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "one\ntwo\n"; string(got) != want {
+		t.Errorf("got file contents %q, want %q", got, want)
+	}
+	if want := "reply appended to " + out; !strings.Contains(ui.out.String(), want) {
+		t.Errorf("output does not contain %q:\n%s", want, ui.out.String())
+	}
+}
+
+func TestNoRedirect(t *testing.T) {
+	dir := t.TempDir()
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+
+	pasted := "why does this fail?\nset -e\necho done > log.txt"
+	srv, _ := runInteractive(t, nil, "is 5 > 3", pasted, "> quoted text")
+
+	var got []string
+	for _, r := range srv.Requests() {
+		req, err := r.Chat()
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, req.Messages[len(req.Messages)-1].Content)
+	}
+	if want := []string{"is 5 > 3", pasted, "> quoted text"}; strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Errorf("got prompts %q, want %q", got, want)
+	}
+	if files, _ := os.ReadDir(dir); len(files) != 0 {
+		t.Errorf("replies written to files: %v", files)
+	}
+}
+
+func TestUsage(t *testing.T) {
+	usage := chat.Usage{PromptTokens: 10, CompletionTokens: 20, TotalTokens: 30}
+	srv, ui := runInteractive(t, func(srv *apitest.Server) {
+		srv.Push(apitest.Reply{Usage: usage}, apitest.Reply{Usage: usage})
+	}, "show_usage", "hello", "stream=true", "again", "usage", "budget=0.0004", "more")
+
+	if n := len(srv.Requests()); n != 2 {
+		t.Errorf("got %d requests, want 2", n)
+	}
+	out := ui.out.String()
+	for _, want := range []string{
+		"tokens: 10 prompt + 20 completion = 30, cost: $0.0002 (session: $0.0002)",
+		"tokens: 10 prompt + 20 completion = 30, cost: $0.0002 (session: $0.0004)",
+		"gpt-4o         2      20          40     60  $0.0004",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output does not contain %q:\n%s", want, out)
+		}
+	}
+	if got, want := ui.errs.String(), "session budget of $0.0004 reached"; !strings.Contains(got, want) {
+		t.Errorf("got errors\n%s\nwant them to contain %q", got, want)
+	}
+}
+
+func TestSessions(t *testing.T) {
+	_, ui, o := setup(t, nil)
+	sh := &shell{o: o, conv: &conversation{}}
+	run := func(input ...string) {
+		t.Helper()
+		for _, in := range input {
+			if err := sh.execute(context.Background(), in); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	run("temperature=0.5", "first question\nwith details", "follow-up")
+	if sh.session == nil {
+		t.Fatal("conversation was not saved")
+	}
+	id := sh.session.ID
+	run("clear", "temperature=1", "another topic", "session rename "+id+" renamed", "sessions")
+	if got := ui.out.String(); !strings.Contains(got, id+"  ") || !strings.Contains(got, "renamed") {
+		t.Errorf("sessions not listed:\n%s", got)
+	}
+
+	ui.out.Reset()
+	run("session resume "+id[:4], "show", "session")
+	want := "[user]\nfirst question\nwith details\n\n[assistant]\necho: first question\nwith details\n\n" +
+		"[user]\nfollow-up\n\n[assistant]\necho: follow-up\n"
+	if got := ui.out.String(); !strings.Contains(got, want) {
+		t.Errorf("resumed conversation\n%s\nwant\n%s", got, want)
+	}
+	if got := ui.out.String(); !strings.Contains(got, id+"  renamed\n") {
+		t.Errorf("current session not shown:\n%s", got)
+	}
+	if got := currentConfig().Temperature; got != 0.5 {
+		t.Errorf("resumed temperature %v, want 0.5", got)
+	}
+
+	// Prompts and abbreviated IDs do not rename or delete sessions,
+	// they are sent as prompts.
+	run("rename this variable to snake_case", "session delete "+id[:4], "session cookies or tokens")
+	if s, err := findSession(id); err != nil || s.Title != "renamed" {
+		t.Errorf("session %s changed: %v", id, err)
+	}
+	if n := len(sh.conv.messages); n != 10 {
+		t.Errorf("conversation holds %d messages, want 10", n)
+	}
+	if ui.errs.Len() > 0 {
+		t.Errorf("unexpected errors:\n%s", ui.errs.String())
+	}
+
+	ui.errs.Reset()
+	run("session delete " + id)
+	if _, err := findSession(id); err == nil {
+		t.Errorf("session %s not deleted", id)
+	}
+	if ui.errs.Len() > 0 {
+		t.Errorf("unexpected errors:\n%s", ui.errs.String())
+	}
+}
+
+func TestSystem(t *testing.T) {
+	fname := filepath.Join(t.TempDir(), "system.txt")
+	if err := os.WriteFile(fname, []byte("Answer in French.\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	srv, ui := runInteractive(t, nil, "persona sql", "system=@"+fname, "hello")
+
+	req, ok := srv.LastRequest()
+	if !ok {
+		t.Fatal("no request sent")
+	}
+	chat, err := req.Chat()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := builtinPersonas["sql"] + "\n\nAnswer in French."
+	if m := chat.Messages[0]; m.Role != "system" || m.Content != want {
+		t.Errorf("got first message %s: %q, want system: %q", m.Role, m.Content, want)
+	}
+	if ui.errs.Len() > 0 {
+		t.Errorf("unexpected errors:\n%s", ui.errs.String())
+	}
+}
+
+func TestComplete(t *testing.T) {
+	_, _, o := setup(t, nil)
+	sh := &shell{o: o, conv: &conversation{}}
+	dir := t.TempDir()
+	for _, name := range []string{"main.go", "main_test.go", "pkg/util.go"} {
+		fname := filepath.Join(dir, name)
+		os.MkdirAll(filepath.Dir(fname), 0755)
+		if err := os.WriteFile(fname, nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	wd, _ := os.Getwd()
+	t.Cleanup(func() { os.Chdir(wd) })
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		line string
+		want []string
+	}{
+		{line: "pro", want: []string{"profile", "profiles"}},
+		{line: "session r", want: []string{"rename", "resume"}},
+		{line: "session resume ", want: nil},
+		{line: "tem", want: []string{"temperature="}},
+		{line: "stre", want: []string{"stream"}},
+		{line: "endpoint=c", want: []string{"endpoint=chat", "endpoint=completions"}},
+		{line: "model=gpt-4o", want: []string{"model=gpt-4o", "model=gpt-4o-mini"}},
+		{line: "model gpt-3", want: []string{"gpt-3.5-turbo-instruct"}},
+		{line: "persona s", want: []string{"shell", "sql"}},
+		{line: "explain @ma", want: []string{"@main.go", "@main_test.go"}},
+		{line: "explain @p", want: []string{"@pkg/"}},
+		{line: "explain @pkg/", want: []string{"@pkg/util.go"}},
+		{line: "explain th", want: nil},
+	} {
+		if got := sh.complete(tc.line); strings.Join(got, " ") != strings.Join(tc.want, " ") {
+			t.Errorf("complete(%q) = %q, want %q", tc.line, got, tc.want)
+		}
+	}
+}
+
+func TestHistory(t *testing.T) {
+	srv, ui := runInteractive(t, nil, "hello", " secret", "history=off", "hidden", "history=on",
+		"hello", "history", "history 1")
+
+	if n := len(srv.Requests()); n != 5 {
+		t.Errorf("got %d requests, want 5", n)
+	}
+	if got, want := ui.out.String(), "    1 hello\n"; !strings.Contains(got, want) {
+		t.Errorf("history listed as\n%s\nwant\n%s", got, want)
+	}
+	h, err := loadHistory()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := strings.Join(h.entries, "|"), "history|hello|history 1"; got != want {
+		t.Errorf("got history %q, want %q", got, want)
+	}
+}
+
+func TestMultiline(t *testing.T) {
+	srv, ui := runInteractive(t, nil,
+		`first \`, `second`,
+		`"""`, `func f() {`, `	return`, `}`, `"""`,
+		`"""one line"""`,
+		"multiline=on", "para", "graph", "", "history of rome", "in brief", "", "multiline=off",
+		`cut \`)
+
+	var got []string
+	for _, r := range srv.Requests() {
+		req, err := r.Chat()
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, req.Messages[len(req.Messages)-1].Content)
+	}
+	want := []string{"first \nsecond", "func f() {\n\treturn\n}", "one line", "para\ngraph", "history of rome\nin brief", "cut"}
+	if strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Errorf("got prompts %q, want %q", got, want)
+	}
+	if ui.errs.Len() > 0 {
+		t.Errorf("unexpected errors:\n%s", ui.errs.String())
+	}
+
+	r := bufio.NewReader(strings.NewReader("x \x1b[200~a\nb\n\x1b[201~y\nnext\n"))
+	for _, want := range []string{"x a\nb\ny\n", "next\n"} {
+		if got, err := readPasted(r); err != nil || got != want {
+			t.Errorf("readPasted() = %q, %v, want %q", got, err, want)
+		}
+	}
+}
+
+// editorScript writes a shell script running commands on the file
+// given as $1 and returns its path, to be used as $VISUAL.
+func editorScript(t *testing.T, commands string) string {
+	t.Helper()
+	name := filepath.Join(t.TempDir(), "editor")
+	if err := os.WriteFile(name, []byte("#!/bin/sh\n"+commands+"\n"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	return name
+}
+
+func TestEdit(t *testing.T) {
+	_, ui, o := setup(t, nil)
+	sh := &shell{o: o, conv: &conversation{}}
+	ctx := context.Background()
+
+	// The editor sees the last prompt and the template.
+	seen := filepath.Join(t.TempDir(), "seen")
+	t.Setenv("EDITOR", "")
+	t.Setenv("VISUAL", editorScript(t, "cp \"$1\" '"+seen+"'\nprintf 'two\\n' > \"$1\""))
+	for _, input := range []string{"one", "edit"} {
+		if err := sh.execute(ctx, input); err != nil {
+			t.Fatal(err)
+		}
+	}
+	data, err := os.ReadFile(seen)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "one\n\n" + editTemplate; string(data) != want {
+		t.Errorf("editor opened on %q, want %q", data, want)
+	}
+
+	t.Setenv("VISUAL", editorScript(t, "printf 'three\\n' > \"$1\""))
+	if err := sh.execute(ctx, "edit last"); err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, m := range sh.conv.messages {
+		got = append(got, m.Content)
+	}
+	want := []string{"one", "echo: one", "three", "echo: three"}
+	if strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Errorf("got conversation %q, want %q", got, want)
+	}
+
+	t.Setenv("VISUAL", editorScript(t, "cp /dev/null \"$1\""))
+	if err := sh.execute(ctx, "edit last"); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(sh.conv.messages); n != 4 {
+		t.Errorf("empty edit changed the conversation to %d messages", n)
+	}
+	if got, want := ui.errs.String(), "prompt is empty, nothing sent\n"; got != want {
+		t.Errorf("got errors %q, want %q", got, want)
+	}
+
+	// A request failing once the new turn was added keeps the old one.
+	ui.errs.Reset()
+	o.Writer = failingWriter{}
+	if err := configure("output", "reply.txt"); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("VISUAL", editorScript(t, "printf 'four\\n' > \"$1\""))
+	if err := sh.execute(ctx, "edit last"); err != nil {
+		t.Fatal(err)
+	}
+	got = nil
+	for _, m := range sh.conv.messages {
+		got = append(got, m.Content)
+	}
+	if strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Errorf("got conversation %q after a failed edit, want %q", got, want)
+	}
+	if got := ui.errs.String(); !strings.Contains(got, "disk full") {
+		t.Errorf("got errors %q, want the failure to close the output", got)
+	}
+}
+
+// failingWriter is a Writer whose files fail to be closed.
+type failingWriter struct{}
+
+func (failingWriter) Open(name string) (io.WriteCloser, error) {
+	return failingFile{}, nil
+}
+
+type failingFile struct{}
+
+func (failingFile) Write(b []byte) (int, error) { return len(b), nil }
+func (failingFile) Close() error                { return errors.New("disk full") }
+
+func TestCommandArguments(t *testing.T) {
+	srv, ui := runInteractive(t, nil, "usage reset", "history 1", "pricing gpt-4o 2.5 10", "help history")
+
+	if n := len(srv.Requests()); n != 0 {
+		t.Errorf("got %d requests, want none", n)
+	}
+	if ui.errs.Len() > 0 {
+		t.Errorf("unexpected errors:\n%s", ui.errs.String())
+	}
+	out := ui.out.String()
+	for _, want := range []string{"history [<n>]\n", "history=<bool>\n", "Accepts on and off."} {
+		if !strings.Contains(out, want) {
+			t.Errorf("help does not contain %q:\n%s", want, out)
+		}
+	}
+}
+
+func TestCommandNamePrompts(t *testing.T) {
+	prompts := []string{
+		"clear the redis cache for me", "show me how to reverse a list", "drop table users",
+		"help me write a regex", "model the data as a graph", "delete the duplicate rows in sql",
+		"usage of goroutines in go", "history of rome", "rename variables in this code",
+		"models are cool explain", "resume a b", "usage reset now", "profile this function",
+		"persona of a villain", "pricing of gpt", "exit now",
+	}
+	srv, ui := runInteractive(t, nil, append([]string{"hello"}, prompts...)...)
+
+	var got []string
+	for _, r := range srv.Requests() {
+		req, err := r.Chat()
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, req.Messages[len(req.Messages)-1].Content)
+	}
+	if want := append([]string{"hello"}, prompts...); strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Errorf("got prompts %q, want %q", got, want)
+	}
+	// The conversation was neither cleared nor shortened.
+	req, _ := srv.LastRequest()
+	last, err := req.Chat()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n, want := len(last.Messages), 2*len(prompts)+1; n != want {
+		t.Errorf("last request holds %d messages, want %d", n, want)
+	}
+	if ui.errs.Len() > 0 {
+		t.Errorf("unexpected errors:\n%s", ui.errs.String())
+	}
+}
+
+func TestSaveLoadArguments(t *testing.T) {
+	srv, ui := runInteractive(t, nil, "temperature=0.3", "load a CSV in pandas", "save a file in python")
+
+	if got := currentConfig().Temperature; got != 0.3 {
+		t.Errorf("got temperature %v, want 0.3", got)
+	}
+	fname, err := settingsFileName()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(fname); !os.IsNotExist(err) {
+		t.Errorf("settings file written: %v", err)
+	}
+	if n := len(srv.Requests()); n != 2 {
+		t.Errorf("got %d requests, want 2", n)
+	}
+	if ui.errs.Len() > 0 {
+		t.Errorf("unexpected errors:\n%s", ui.errs.String())
+	}
+}
@@ -0,0 +1,481 @@
+// MIT License
+//
+// Copyright (c) 2023 Kevin Herro
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+package driver
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/kevherro/vyx/internal/plugin"
+)
+
+// Styles of rendered Markdown, as ANSI escape sequences.
+const (
+	styleReset     = "\x1b[0m"
+	styleBold      = "\x1b[1m"
+	styleDim       = "\x1b[2m"
+	styleItalic    = "\x1b[3m"
+	styleUnderline = "\x1b[4m"
+	styleStrike    = "\x1b[9m"
+	styleHeading   = "\x1b[1;36m"
+	styleCode      = "\x1b[33m"
+	styleKeyword   = "\x1b[35m"
+	styleString    = "\x1b[32m"
+	styleNumber    = "\x1b[36m"
+	styleComment   = "\x1b[90m"
+)
+
+var (
+	fenceRE   = regexp.MustCompile("^(```+|~~~+)\\s*(\\S*)")
+	headingRE = regexp.MustCompile(`^(#{1,6})\s+(.*?)(\s+#+)?$`)
+	ruleRE    = regexp.MustCompile(`^([-*_])(\s*([-*_])){2,}$`)
+	quoteRE   = regexp.MustCompile(`^>\s?(.*)$`)
+	listRE    = regexp.MustCompile(`^(\s*)([-*+]|\d+[.)])\s+(.*)$`)
+	tableSep  = regexp.MustCompile(`^\|?(\s*:?-+:?\s*\|)*\s*:?-+:?\s*\|?$`)
+	ansiRE    = regexp.MustCompile("\x1b\\[[0-9;]*m")
+
+	codeSpanRE = regexp.MustCompile("`([^`]+)`")
+	boldRE     = regexp.MustCompile(`\*\*([^*]+)\*\*|__([^_]+)__`)
+	italicRE   = regexp.MustCompile(`\*([^*\s][^*]*)\*|(^|[^\w])_([^_\s][^_]*)_([^\w]|$)`)
+	strikeRE   = regexp.MustCompile(`~~([^~]+)~~`)
+	linkRE     = regexp.MustCompile(`\[([^\]]+)\]\(([^)\s]+)\)`)
+)
+
+// markdown renders Markdown text for a terminal, line by line.
+// Incomplete lines and the rows of tables are held until complete.
+type markdown struct {
+	width int  // Width to wrap text to, in columns.
+	color bool // Whether to style text with escape sequences.
+
+	print func(text string) // Shows rendered lines.
+
+	line  strings.Builder // Pending incomplete line.
+	fence string          // Fence of the open code block, if any.
+	lang  string          // Language of the open code block.
+	table []string        // Pending rows of a table.
+}
+
+// markdownFor returns a renderer for the replies shown on ui, or written
+// to stdout if not nil. It returns nil if cfg asks for raw replies, or
+// if they do not go to a terminal.
+func markdownFor(cfg config, ui plugin.UI, stdout io.Writer) *markdown {
+	if cfg.Format != "markdown" {
+		return nil
+	}
+	width := 0
+	if t, ok := ui.(plugin.TerminalUI); ok {
+		width = t.Width()
+	}
+	if stdout != nil {
+		f, ok := stdout.(*os.File)
+		if !ok || !isTerminal(f) {
+			return nil
+		}
+		if width <= 0 {
+			width = 80
+		}
+	}
+	if width <= 0 {
+		return nil
+	}
+	return &markdown{width: width, color: os.Getenv("NO_COLOR") == ""}
+}
+
+// write renders the complete lines of text, holding the rest.
+func (m *markdown) write(text string) {
+	m.line.WriteString(text)
+	text = m.line.String()
+	i := strings.LastIndexByte(text, '\n')
+	if i == -1 {
+		return
+	}
+	m.line.Reset()
+	m.line.WriteString(text[i+1:])
+	var b strings.Builder
+	for _, line := range strings.Split(text[:i], "\n") {
+		b.WriteString(m.render(line))
+	}
+	if b.Len() > 0 {
+		m.print(b.String())
+	}
+}
+
+// flush renders whatever is pending, ending the text.
+func (m *markdown) flush() {
+	var b strings.Builder
+	if m.line.Len() > 0 {
+		b.WriteString(m.render(m.line.String()))
+		m.line.Reset()
+	}
+	b.WriteString(m.endTable())
+	m.fence, m.lang = "", ""
+	if b.Len() > 0 {
+		m.print(b.String())
+	}
+}
+
+// render returns line rendered, followed by a newline, or nothing if
+// the line is held as part of a table.
+func (m *markdown) render(line string) string {
+	line = strings.TrimRight(line, "\r")
+	trimmed := strings.TrimSpace(line)
+	if m.fence != "" {
+		if strings.HasPrefix(trimmed, m.fence) && strings.Trim(trimmed, m.fence[:1]) == "" {
+			m.fence, m.lang = "", ""
+			return m.style(styleDim, trimmed) + "\n"
+		}
+		return m.highlight(line) + "\n"
+	}
+	if strings.HasPrefix(trimmed, "|") {
+		m.table = append(m.table, trimmed)
+		return ""
+	}
+
+	out := m.endTable()
+	if f := fenceRE.FindStringSubmatch(trimmed); f != nil {
+		m.fence, m.lang = f[1], strings.ToLower(f[2])
+		return out + m.style(styleDim, trimmed) + "\n"
+	}
+	if h := headingRE.FindStringSubmatch(trimmed); h != nil {
+		if !m.color {
+			return out + m.wrap(h[1]+" "+h[2], "", "") + "\n"
+		}
+		style := styleHeading
+		if len(h[1]) == 1 {
+			style += styleUnderline
+		}
+		return out + m.wrap(m.style(style, h[2]), "", "") + "\n"
+	}
+	if ruleRE.MatchString(trimmed) {
+		return out + m.style(styleDim, strings.Repeat("─", m.width)) + "\n"
+	}
+	if q := quoteRE.FindStringSubmatch(trimmed); q != nil {
+		bar := m.style(styleDim, "│") + " "
+		return out + m.wrap(m.inline(q[1]), bar, bar) + "\n"
+	}
+	if l := listRE.FindStringSubmatch(line); l != nil {
+		bullet := l[2]
+		if !unicode.IsDigit(rune(bullet[0])) {
+			bullet = "•"
+		}
+		indent := strings.Repeat(" ", len(l[1]))
+		first := indent + bullet + " "
+		rest := indent + strings.Repeat(" ", utf8.RuneCountInString(bullet)+1)
+		return out + m.wrap(m.inline(l[3]), first, rest) + "\n"
+	}
+	return out + m.wrap(m.inline(line), "", "") + "\n"
+}
+
+// endTable renders the pending rows of a table, if any.
+func (m *markdown) endTable() string {
+	if len(m.table) == 0 {
+		return ""
+	}
+	var rows [][]string
+	header := -1 // Index of the row above the separator, if any.
+	for i, r := range m.table {
+		if i == 1 && tableSep.MatchString(r) {
+			header = 0
+			continue
+		}
+		var cells []string
+		for _, c := range strings.Split(strings.Trim(r, "|"), "|") {
+			cells = append(cells, m.inline(strings.TrimSpace(c)))
+		}
+		rows = append(rows, cells)
+	}
+	m.table = nil
+
+	var widths []int
+	for _, r := range rows {
+		for i, c := range r {
+			if i == len(widths) {
+				widths = append(widths, 0)
+			}
+			if w := visibleLen(c); w > widths[i] {
+				widths[i] = w
+			}
+		}
+	}
+	sep := " " + m.style(styleDim, "│") + " "
+	var b strings.Builder
+	for i, r := range rows {
+		for j, w := range widths {
+			if j > 0 {
+				b.WriteString(sep)
+			}
+			c := ""
+			if j < len(r) {
+				c = r[j]
+			}
+			if i == header {
+				c = m.style(styleBold, c)
+			}
+			b.WriteString(c)
+			if j < len(widths)-1 {
+				b.WriteString(strings.Repeat(" ", w-visibleLen(c)))
+			}
+		}
+		b.WriteString("\n")
+		if i == header {
+			var rule []string
+			for _, w := range widths {
+				rule = append(rule, strings.Repeat("─", w))
+			}
+			b.WriteString(m.style(styleDim, strings.Join(rule, "─┼─")) + "\n")
+		}
+	}
+	return b.String()
+}
+
+// wrap wraps text to the width of m, starting the first line with
+// first and the others with rest.
+func (m *markdown) wrap(text, first, rest string) string {
+	words := strings.Fields(text)
+	if len(words) == 0 {
+		return strings.TrimRight(first, " ")
+	}
+	var b strings.Builder
+	b.WriteString(first)
+	col := visibleLen(first)
+	start := true // Whether the line has no words yet.
+	for _, w := range words {
+		n := visibleLen(w)
+		if !start && col+1+n > m.width {
+			b.WriteString("\n" + rest)
+			col, start = visibleLen(rest), true
+		}
+		if !start {
+			b.WriteString(" ")
+			col++
+		}
+		b.WriteString(w)
+		col += n
+		start = false
+	}
+	return b.String()
+}
+
+// inline renders the emphasis, code spans and links in text.
+func (m *markdown) inline(text string) string {
+	if !m.color {
+		return text
+	}
+	var b strings.Builder
+	last := 0
+	for _, c := range codeSpanRE.FindAllStringSubmatchIndex(text, -1) {
+		b.WriteString(m.emphasis(text[last:c[0]]))
+		b.WriteString(m.style(styleCode, text[c[2]:c[3]]))
+		last = c[1]
+	}
+	b.WriteString(m.emphasis(text[last:]))
+	return b.String()
+}
+
+// emphasis renders the emphasis and links in text.
+func (m *markdown) emphasis(text string) string {
+	text = linkRE.ReplaceAllString(text, styleUnderline+"$1"+styleReset+" "+styleDim+"($2)"+styleReset)
+	text = boldRE.ReplaceAllString(text, styleBold+"$1$2"+styleReset)
+	text = strikeRE.ReplaceAllString(text, styleStrike+"$1"+styleReset)
+	return italicRE.ReplaceAllString(text, "$2"+styleItalic+"$1$3"+styleReset+"$4")
+}
+
+// style returns text styled with style, if m uses styles.
+func (m *markdown) style(style, text string) string {
+	if !m.color || text == "" {
+		return text
+	}
+	return style + text + styleReset
+}
+
+// visibleLen returns the number of columns text takes on a terminal.
+func visibleLen(text string) int {
+	return utf8.RuneCountInString(ansiRE.ReplaceAllString(text, ""))
+}
+
+// syntax describes the tokens of a language to highlight.
+type syntax struct {
+	keywords map[string]bool
+	comment  string // Starts a comment running to the end of the line.
+	fold     bool   // Whether keywords are case-insensitive.
+}
+
+// syntaxes holds the syntax of languages, keyed by the names of the
+// languages used in code blocks.
+var syntaxes = map[string]*syntax{}
+
+func init() {
+	for _, l := range []struct {
+		names    string
+		keywords string
+		comment  string
+		fold     bool
+	}{
+		{
+			names: "go golang",
+			keywords: "break case chan const continue default defer else fallthrough for func go goto if " +
+				"import interface map package range return select struct switch type var true false nil iota",
+			comment: "//",
+		},
+		{
+			names: "python py python3",
+			keywords: "and as assert async await break class continue def del elif else except False finally " +
+				"for from global if import in is lambda None nonlocal not or pass raise return True try while with yield self",
+			comment: "#",
+		},
+		{
+			names: "javascript js jsx typescript ts tsx",
+			keywords: "async await break case catch class const continue debugger default delete do else enum " +
+				"export extends false finally for from function if implements import in instanceof interface let " +
+				"new null of private protected public readonly return static super switch this throw true try type " +
+				"typeof undefined var void while yield",
+			comment: "//",
+		},
+		{
+			names: "rust rs",
+			keywords: "as async await break const continue crate dyn else enum extern false fn for if impl in let " +
+				"loop match mod move mut pub ref return self Self static struct super trait true type unsafe use " +
+				"where while None Some Ok Err",
+			comment: "//",
+		},
+		{
+			names: "c h cpp c++ cc java cs csharp kotlin kt swift",
+			keywords: "auto bool boolean break case catch char class const continue default do double else enum " +
+				"extends extern false final float for fun func goto if implements import int let long namespace new " +
+				"null nullptr package private protected public return short signed sizeof static struct switch " +
+				"template this throw true try typedef union unsigned using val var virtual void volatile while",
+			comment: "//",
+		},
+		{
+			names: "bash sh shell zsh console",
+			keywords: "if then else elif fi for while until do done case esac function in return local export " +
+				"echo exit set",
+			comment: "#",
+		},
+		{
+			names: "sql",
+			keywords: "select from where and or not insert into values update set delete create table drop alter " +
+				"join left right inner outer on group by order having limit as distinct null is in like union all " +
+				"primary key index",
+			comment: "--",
+			fold:    true,
+		},
+		{names: "json", keywords: "true false null"},
+		{names: "yaml yml toml", keywords: "true false null", comment: "#"},
+	} {
+		s := &syntax{keywords: map[string]bool{}, comment: l.comment, fold: l.fold}
+		for _, k := range strings.Fields(l.keywords) {
+			s.keywords[k] = true
+		}
+		for _, name := range strings.Fields(l.names) {
+			syntaxes[name] = s
+		}
+	}
+}
+
+// highlight returns line, a line of code, with its keywords, strings,
+// numbers and comments styled, if the language of the code block is
+// known.
+func (m *markdown) highlight(line string) string {
+	s := syntaxes[m.lang]
+	if !m.color || s == nil {
+		return line
+	}
+	var b strings.Builder
+	for i := 0; i < len(line); {
+		c := line[i]
+		switch {
+		case s.comment != "" && strings.HasPrefix(line[i:], s.comment):
+			b.WriteString(m.style(styleComment, line[i:]))
+			return b.String()
+		case c == '"' || c == '\'' || c == '`':
+			end := closingQuote(line, i)
+			if end == -1 {
+				b.WriteByte(c)
+				i++
+				continue
+			}
+			b.WriteString(m.style(styleString, line[i:end+1]))
+			i = end + 1
+		case isWordByte(c):
+			j := i
+			for j < len(line) && (isWordByte(line[j]) || c >= '0' && c <= '9' && line[j] == '.') {
+				j++
+			}
+			word := line[i:j]
+			key := word
+			if s.fold {
+				key = strings.ToLower(word)
+			}
+			switch {
+			case c >= '0' && c <= '9':
+				b.WriteString(m.style(styleNumber, word))
+			case s.keywords[key]:
+				b.WriteString(m.style(styleKeyword, word))
+			default:
+				b.WriteString(word)
+			}
+			i = j
+		default:
+			b.WriteByte(c)
+			i++
+		}
+	}
+	return b.String()
+}
+
+// closingQuote returns the index of the quote closing the one at
+// line[start], skipping escaped quotes, or -1 if there is none.
+func closingQuote(line string, start int) int {
+	q := line[start]
+	for i := start + 1; i < len(line); i++ {
+		switch line[i] {
+		case '\\':
+			i++
+		case q:
+			return i
+		}
+	}
+	return -1
+}
+
+// isWordByte returns true if c may be part of an identifier or number.
+func isWordByte(c byte) bool {
+	return c == '_' || c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+// markdownUI is a UI that renders the replies shown on the UI it wraps
+// as Markdown.
+type markdownUI struct {
+	plugin.UI
+	md *markdown
+}
+
+func (u *markdownUI) Print(args ...any) {
+	text := fmt.Sprint(args...)
+	if !strings.HasSuffix(text, "\n") {
+		text += "\n"
+	}
+	u.md.write(text)
+}
+
+func (u *markdownUI) PrintPartial(args ...any) {
+	u.md.write(fmt.Sprint(args...))
+}
@@ -0,0 +1,134 @@
+// MIT License
+//
+// Copyright (c) 2023 Kevin Herro
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+package driver
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/kevherro/vyx/internal/apitest"
+)
+
+func TestMarkdown(t *testing.T) {
+	const text = "# Title\n" +
+		"Some **bold** text that is long enough to be wrapped.\n" +
+		"- item\n" +
+		"  1. nested item that wraps\n" +
+		"> quote\n" +
+		"***\n" +
+		"| name | size |\n" +
+		"|------|-----:|\n" +
+		"| a    | 1000 |\n" +
+		"```go\n" +
+		"return \"x\" // done\n" +
+		"```\n" +
+		"end"
+
+	for _, tc := range []struct {
+		color bool
+		want  string
+	}{
+		{
+			color: false,
+			want: "# Title\n" +
+				"Some **bold** text that is long\n" +
+				"enough to be wrapped.\n" +
+				"• item\n" +
+				"  1. nested item that wraps\n" +
+				"│ quote\n" +
+				strings.Repeat("─", 32) + "\n" +
+				"name │ size\n" +
+				"─────┼─────\n" +
+				"a    │ 1000\n" +
+				"```go\n" +
+				"return \"x\" // done\n" +
+				"```\n" +
+				"end\n",
+		},
+		{
+			color: true,
+			want: styleHeading + styleUnderline + "Title" + styleReset + "\n" +
+				"Some " + styleBold + "bold" + styleReset + " text that is long\n" +
+				"enough to be wrapped.\n" +
+				"• item\n" +
+				"  1. nested item that wraps\n" +
+				styleDim + "│" + styleReset + " quote\n" +
+				styleDim + strings.Repeat("─", 32) + styleReset + "\n" +
+				styleBold + "name" + styleReset + " " + styleDim + "│" + styleReset + " " + styleBold + "size" + styleReset + "\n" +
+				styleDim + "─────┼─────" + styleReset + "\n" +
+				"a    " + styleDim + "│" + styleReset + " 1000\n" +
+				styleDim + "```go" + styleReset + "\n" +
+				styleKeyword + "return" + styleReset + " " + styleString + `"x"` + styleReset + " " + styleComment + "// done" + styleReset + "\n" +
+				styleDim + "```" + styleReset + "\n" +
+				"end\n",
+		},
+	} {
+		var got strings.Builder
+		m := &markdown{width: 32, color: tc.color, print: func(text string) { got.WriteString(text) }}
+		// Pieces split lines, as streamed replies do.
+		for i := 0; i < len(text); i += 7 {
+			end := i + 7
+			if end > len(text) {
+				end = len(text)
+			}
+			m.write(text[i:end])
+		}
+		m.flush()
+		if got.String() != tc.want {
+			t.Errorf("rendered with color=%v as\n%q\nwant\n%q", tc.color, got.String(), tc.want)
+		}
+	}
+}
+
+// termUI is a testUI showing messages on a terminal.
+type termUI struct {
+	*testUI
+}
+
+func (termUI) Width() int { return 40 }
+
+func TestMarkdownFormat(t *testing.T) {
+	_, ui, o := setup(t, func(srv *apitest.Server) {
+		for _, text := range []string{"**a**", "**b**", "**c**", "**d**", "**e**"} {
+			srv.Push(apitest.Reply{Text: text})
+		}
+	})
+	o.UI = termUI{ui}
+	sh := &shell{o: o, conv: &conversation{}}
+	t.Setenv("NO_COLOR", "")
+	for _, input := range []string{"raw", "one", "markdown", "two", "stream=true", "three"} {
+		if err := sh.execute(context.Background(), input); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Without colors or a terminal, emphasis is left as is.
+	t.Setenv("NO_COLOR", "1")
+	if err := sh.execute(context.Background(), "four"); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("NO_COLOR", "")
+	sh.o.UI = ui
+	if err := sh.execute(context.Background(), "five"); err != nil {
+		t.Fatal(err)
+	}
+
+	bold := func(s string) string { return styleBold + s + styleReset }
+	want := "**a**\n" + bold("b") + "\n" + bold("c") + "\n**d**\n**e**\n"
+	if got := ui.out.String(); got != want {
+		t.Errorf("got output %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,232 @@
+// MIT License
+//
+// Copyright (c) 2023 Kevin Herro
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+package driver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/kevherro/vyx/internal/api/models"
+	"github.com/kevherro/vyx/internal/plugin"
+)
+
+// modelCache holds the models available through the API. They are
+// fetched once and cached for the rest of the session.
+var modelCache struct {
+	sync.Mutex
+	models []models.Model
+}
+
+// maxOutputTokensByModel holds the most tokens common models can
+// generate in a reply.
+var maxOutputTokensByModel = map[string]int{
+	"gpt-4o":        16384,
+	"gpt-4o-mini":   16384,
+	"gpt-4.1":       32768,
+	"gpt-4.1-mini":  32768,
+	"gpt-4.1-nano":  32768,
+	"gpt-4-turbo":   4096,
+	"gpt-4":         8192,
+	"gpt-3.5-turbo": 4096,
+	"o1":            100000,
+	"o1-mini":       65536,
+	"o3":            100000,
+	"o3-mini":       100000,
+	"o4-mini":       100000,
+}
+
+// maxOutputTokens returns the most tokens model can generate in a
+// reply, and false if it is unknown.
+func maxOutputTokens(model string) (int, bool) {
+	return lookupByModel(maxOutputTokensByModel, model)
+}
+
+// contextWindowByModel holds the most tokens the prompt and reply of a
+// request to common models may take together.
+var contextWindowByModel = map[string]int{
+	"gpt-4o":                 128000,
+	"gpt-4o-mini":            128000,
+	"gpt-4.1":                1047576,
+	"gpt-4.1-mini":           1047576,
+	"gpt-4.1-nano":           1047576,
+	"gpt-4-turbo":            128000,
+	"gpt-4":                  8192,
+	"gpt-4-32k":              32768,
+	"gpt-3.5-turbo":          16385,
+	"gpt-3.5-turbo-instruct": 4096,
+	"o1":                     200000,
+	"o1-mini":                128000,
+	"o3":                     200000,
+	"o3-mini":                200000,
+	"o4-mini":                200000,
+}
+
+// contextWindow returns the size of the context window of model, in
+// tokens, and false if it is unknown.
+func contextWindow(model string) (int, bool) {
+	return lookupByModel(contextWindowByModel, model)
+}
+
+// lookupByModel returns the value for model in table, whose keys are
+// model IDs. Models are matched by ID or, for versioned IDs, by the
+// longest ID they extend, so that "gpt-4o" matches "gpt-4o-2024-08-06"
+// but not "gpt-4o-mini" if the latter is in table.
+func lookupByModel[V any](table map[string]V, model string) (V, bool) {
+	var best string
+	found := false
+	for id := range table {
+		if (model == id || strings.HasPrefix(model, id+"-")) && len(id) >= len(best) {
+			best, found = id, true
+		}
+	}
+	return table[best], found
+}
+
+// knownModelIDs returns the IDs of the models available through the
+// API, if they were fetched already, and of the common models.
+func knownModelIDs() []string {
+	modelCache.Lock()
+	defer modelCache.Unlock()
+	var ids []string
+	for _, m := range modelCache.models {
+		ids = append(ids, m.ID)
+	}
+	for id := range contextWindowByModel {
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+// isModelID returns true if id may name a model: a known one, a
+// version of one, or an ID holding a digit or separator, as most do.
+func isModelID(id string) bool {
+	for _, known := range knownModelIDs() {
+		if id == known || strings.HasPrefix(id, known+"-") {
+			return true
+		}
+	}
+	return strings.ContainsAny(id, "0123456789-.:/")
+}
+
+// isModelFilter returns true if every one of the filter tokens is part
+// of a model ID, as in "models gpt mini" but not "models are fun".
+func isModelFilter(filter []string) bool {
+	ids := knownModelIDs()
+outer:
+	for _, tok := range filter {
+		if isModelID(tok) {
+			continue
+		}
+		for _, id := range ids {
+			if strings.Contains(id, tok) {
+				continue outer
+			}
+		}
+		return false
+	}
+	return true
+}
+
+// availableModels returns the models available through the API.
+func availableModels(ctx context.Context, o *plugin.Options) ([]models.Model, error) {
+	modelCache.Lock()
+	defer modelCache.Unlock()
+	if modelCache.models != nil {
+		return modelCache.models, nil
+	}
+
+	var list models.List
+	if err := send(ctx, o, models.Method, models.Path, nil, &list); err != nil {
+		return nil, err
+	}
+	if list.Data == nil {
+		return nil, errors.New("the models list is empty or could not be read")
+	}
+	modelCache.models = list.Data
+	return list.Data, nil
+}
+
+// lookupModel returns the model with the given ID.
+func lookupModel(ctx context.Context, id string, o *plugin.Options) (models.Model, error) {
+	list, err := availableModels(ctx, o)
+	if err != nil {
+		return models.Model{}, err
+	}
+	for _, m := range list {
+		if m.ID == id {
+			return m, nil
+		}
+	}
+	return models.Model{}, fmt.Errorf("unknown model %q, type \"models\" for the list", id)
+}
+
+// checkModel verifies that id names an available model before it is
+// assigned to the model field. If the list of models cannot be fetched,
+// the assignment is let through with a warning.
+func checkModel(ctx context.Context, id string, o *plugin.Options) error {
+	if _, err := availableModels(ctx, o); err != nil {
+		o.UI.PrintErr("cannot verify model: ", err)
+		return nil
+	}
+	_, err := lookupModel(ctx, id, o)
+	return err
+}
+
+// listModels shows the IDs of the available models that contain
+// every one of the filter tokens.
+func listModels(ctx context.Context, filter []string, o *plugin.Options) error {
+	list, err := availableModels(ctx, o)
+	if err != nil {
+		return err
+	}
+	ids := matchingModels(list, filter)
+	if len(ids) == 0 {
+		o.UI.Print("no matching models")
+		return nil
+	}
+	o.UI.Print(strings.Join(ids, "\n"))
+	return nil
+}
+
+// matchingModels returns the sorted IDs of the models in list whose ID
+// contains every one of the filter tokens.
+func matchingModels(list []models.Model, filter []string) []string {
+	var ids []string
+outer:
+	for _, m := range list {
+		for _, tok := range filter {
+			if !strings.Contains(m.ID, tok) {
+				continue outer
+			}
+		}
+		ids = append(ids, m.ID)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// describeModel shows the properties of the model with the given ID.
+func describeModel(ctx context.Context, id string, o *plugin.Options) error {
+	m, err := lookupModel(ctx, id, o)
+	if err != nil {
+		return err
+	}
+	o.UI.Print(m.String())
+	return nil
+}
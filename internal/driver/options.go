@@ -18,9 +18,12 @@ import (
 	"bufio"
 	"fmt"
 	"io"
+	"net/http"
 	"os"
+	"strconv"
 	"strings"
 
+	"github.com/kevherro/vyx/internal/paste"
 	"github.com/kevherro/vyx/internal/plugin"
 )
 
@@ -33,28 +36,89 @@ func setDefaults(o *plugin.Options) *plugin.Options {
 		d.Writer = writer{}
 	}
 	if d.UI == nil {
-		d.UI = &stdUI{r: bufio.NewReader(os.Stdin)}
+		d.UI = &stdUI{r: bufio.NewReader(os.Stdin), terminal: isTerminal(os.Stdin)}
 	}
+	if d.Stdout == nil {
+		d.Stdout = os.Stdout
+	}
+	if d.HTTPClient == nil {
+		d.HTTPClient = &http.Client{Transport: d.Transport}
+	}
+	if d.BaseURL == "" {
+		d.BaseURL = os.Getenv("OPENAI_BASE_URL")
+	}
+	if d.BaseURL == "" {
+		d.BaseURL = defaultBaseURL
+	}
+	d.BaseURL = strings.TrimSuffix(d.BaseURL, "/")
 	return d
 }
 
+// defaultBaseURL is the URL of the OpenAI API.
+const defaultBaseURL = "https://api.openai.com/v1"
+
 type stdUI struct {
-	r *bufio.Reader
+	r        *bufio.Reader
+	terminal bool // Whether r reads from a terminal, which brackets pastes.
 }
 
 func (ui *stdUI) ReadLine(prompt string) (string, error) {
 	os.Stdout.WriteString(prompt)
-	return ui.r.ReadString('\n')
+	if ui.terminal {
+		defer paste.Enable(os.Stdout)()
+	}
+	return readPasted(ui.r)
+}
+
+// readPasted reads a line from r. If text spanning several lines was
+// pasted in it, the line continues to the end of the paste, so that the
+// text is read whole.
+func readPasted(r *bufio.Reader) (string, error) {
+	line, err := r.ReadString('\n')
+	if err == nil && strings.Contains(line, paste.Start) {
+		for !strings.Contains(line[strings.LastIndex(line, paste.Start):], paste.End) {
+			var more string
+			more, err = r.ReadString('\n')
+			line += more
+			if err != nil {
+				break
+			}
+		}
+	}
+	line = strings.ReplaceAll(line, paste.Start, "")
+	return strings.ReplaceAll(line, paste.End, ""), err
+}
+
+// isTerminal returns true if f is a terminal.
+func isTerminal(f *os.File) bool {
+	fi, err := f.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
 }
 
 func (ui *stdUI) Print(args ...any) {
 	ui.fPrintf(os.Stderr, args)
 }
 
+func (ui *stdUI) PrintPartial(args ...any) {
+	os.Stderr.WriteString(fmt.Sprint(args...))
+}
+
 func (ui *stdUI) PrintErr(args ...any) {
 	ui.fPrintf(os.Stderr, args)
 }
 
+// Width returns the width of the terminal messages are shown on, as
+// set in $COLUMNS, or 0 if they are not shown on a terminal.
+func (ui *stdUI) Width() int {
+	if !isTerminal(os.Stderr) {
+		return 0
+	}
+	if n, err := strconv.Atoi(os.Getenv("COLUMNS")); err == nil && n > 0 {
+		return n
+	}
+	return 80
+}
+
 func (ui *stdUI) fPrintf(f *os.File, args []any) {
 	text := fmt.Sprint(args...)
 	if !strings.HasSuffix(text, "\n") {
@@ -70,3 +134,8 @@ func (writer) Open(name string) (io.WriteCloser, error) {
 	f, err := os.Create(name)
 	return f, err
 }
+
+func (writer) Append(name string) (io.WriteCloser, error) {
+	f, err := os.OpenFile(name, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0666)
+	return f, err
+}
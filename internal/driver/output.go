@@ -0,0 +1,161 @@
+// MIT License
+//
+// Copyright (c) 2023 Kevin Herro
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+package driver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+
+	"github.com/kevherro/vyx/internal/plugin"
+)
+
+// output names where replies are written instead of being shown.
+type output struct {
+	name   string
+	append bool // Add to the existing contents rather than replace them.
+}
+
+// outputFor returns the output configured in cfg, or nil if replies
+// are to be shown.
+func outputFor(cfg config) *output {
+	if cfg.Output == "" {
+		return nil
+	}
+	return &output{name: cfg.Output, append: cfg.OutputMode == "append"}
+}
+
+// open opens out through w.
+func (out *output) open(w plugin.Writer) (io.WriteCloser, error) {
+	if !out.append {
+		return w.Open(out.name)
+	}
+	aw, ok := w.(plugin.AppendWriter)
+	if !ok {
+		return nil, errors.New("the writer cannot append, use output_mode=overwrite")
+	}
+	return aw.Append(out.name)
+}
+
+// redirectRE matches a redirection at the start of a prompt: ">name"
+// to overwrite name, or ">>name" to append to it. The name follows the
+// marker without a space, so that the marker does not read as prose,
+// such as "5 > 3", or as the quotes of Markdown.
+var redirectRE = regexp.MustCompile(`^(>>?)([^\s>]\S*)\s+(\S.*)$`)
+
+// parseRedirect splits a redirection off the start of input. It returns
+// the rest of input and the output it redirects to, or nil if none.
+// Input spanning several lines, typically pasted, is never redirected.
+func parseRedirect(input string) (string, *output) {
+	if strings.Contains(input, "\n") {
+		return input, nil
+	}
+	m := redirectRE.FindStringSubmatch(input)
+	if m == nil {
+		return input, nil
+	}
+	return m[3], &output{name: m[2], append: m[1] == ">>"}
+}
+
+// askTo sends prompt like ask does, writing the reply to out if not
+// nil, or to stdout if not nil, rather than showing it on the UI.
+// The usage of the request is added to the session usage, and the
+// request is refused if the session budget is exhausted.
+func askTo(ctx context.Context, o *plugin.Options, conv *conversation, prompt string, out *output, stdout io.Writer) error {
+	cfg := currentConfig()
+	if err := sessionUsage.checkBudget(cfg.Budget); err != nil {
+		return err
+	}
+	reply, err := replyTo(ctx, o, conv, prompt, out, stdout)
+	if reply != nil {
+		recordUsage(o.UI, cfg, reply.Usage)
+	}
+	return err
+}
+
+// replyTo implements askTo, returning the reply if one was received.
+func replyTo(ctx context.Context, o *plugin.Options, conv *conversation, prompt string, out *output, stdout io.Writer) (*apiReply, error) {
+	if out == nil {
+		ro := o
+		if stdout != nil {
+			ro = withUI(o, &replyUI{UI: o.UI, w: stdout})
+		}
+		if md := markdownFor(currentConfig(), o.UI, stdout); md != nil {
+			ui := ro.UI
+			md.print = func(text string) { ui.Print(text) }
+			defer md.flush()
+			ro = withUI(ro, &markdownUI{UI: ui, md: md})
+		}
+		return ask(ctx, ro, conv, prompt)
+	}
+
+	w, err := out.open(o.Writer)
+	if err != nil {
+		return nil, err
+	}
+	ui := &replyUI{UI: o.UI, w: w}
+	reply, err := ask(ctx, withUI(o, ui), conv, prompt)
+	if err == nil {
+		err = ui.err
+	}
+	if cerr := w.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return reply, fmt.Errorf("%s: %w", out.name, err)
+	}
+	if out.append {
+		o.UI.Print("reply appended to ", out.name)
+	} else {
+		o.UI.Print("reply written to ", out.name)
+	}
+	return reply, nil
+}
+
+// withUI returns a copy of o that uses ui.
+func withUI(o *plugin.Options, ui plugin.UI) *plugin.Options {
+	ro := *o
+	ro.UI = ui
+	return &ro
+}
+
+// replyUI is a UI that writes replies to w, leaving the other
+// messages to the UI it wraps.
+type replyUI struct {
+	plugin.UI
+	w   io.Writer
+	err error // First error writing to w.
+}
+
+func (u *replyUI) Print(args ...any) {
+	text := fmt.Sprint(args...)
+	if !strings.HasSuffix(text, "\n") {
+		text += "\n"
+	}
+	u.write(text)
+}
+
+func (u *replyUI) PrintPartial(args ...any) {
+	u.write(fmt.Sprint(args...))
+}
+
+func (u *replyUI) write(text string) {
+	if u.err == nil {
+		_, u.err = io.WriteString(u.w, text)
+	}
+}
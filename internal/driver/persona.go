@@ -0,0 +1,157 @@
+// MIT License
+//
+// Copyright (c) 2023 Kevin Herro
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+package driver
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/kevherro/vyx/internal/plugin"
+)
+
+// builtinPersonas holds the system messages of the personas available
+// without any settings, keyed by name.
+var builtinPersonas = map[string]string{
+	"reviewer": "You are a meticulous senior software engineer reviewing code. " +
+		"Point out bugs, security issues, unclear naming and missing tests, most important first. " +
+		"Be specific, suggest concrete fixes, and do not restate what the code does.",
+	"sql": "You are an expert in SQL and relational databases. " +
+		"Answer with correct, idiomatic SQL in a fenced code block, followed by a brief explanation. " +
+		"Mention the dialect when it matters and point out performance pitfalls such as missing indexes.",
+	"shell": "You are an expert in Unix shells and command-line tools. " +
+		"Answer with the command to run in a fenced code block, followed by a short explanation of each part. " +
+		"Prefer portable POSIX commands, and warn before anything destructive.",
+}
+
+// personas returns the available personas: the built-in ones and those
+// defined in the settings file, which take precedence.
+func personas() (map[string]string, error) {
+	all := map[string]string{}
+	for name, text := range builtinPersonas {
+		all[name] = text
+	}
+	err := updateSettings(func(s *settings) (bool, error) {
+		for name, text := range s.Personas {
+			all[name] = text
+		}
+		return false, nil
+	})
+	return all, err
+}
+
+// systemMessage returns the system message configured in cfg: the
+// message of its persona, if any, followed by its system field.
+// Either can name a file to read the message from, as "@file".
+func systemMessage(cfg config) (string, error) {
+	var parts []string
+	if cfg.Persona != "" {
+		all, err := personas()
+		if err != nil {
+			return "", err
+		}
+		text, ok := all[cfg.Persona]
+		if !ok {
+			return "", fmt.Errorf("unknown persona %q, type \"persona\" for the list", cfg.Persona)
+		}
+		if text, err = readValue(text); err != nil {
+			return "", err
+		}
+		parts = append(parts, text)
+	}
+	if cfg.System != "" {
+		text, err := readValue(cfg.System)
+		if err != nil {
+			return "", err
+		}
+		parts = append(parts, text)
+	}
+	return strings.TrimSpace(strings.Join(parts, "\n\n")), nil
+}
+
+// readValue returns the contents of the file named by value if it
+// starts with "@", or value itself otherwise. A leading "@@" stands
+// for a literal "@".
+func readValue(value string) (string, error) {
+	switch {
+	case strings.HasPrefix(value, "@@"):
+		return value[1:], nil
+	case strings.HasPrefix(value, "@"):
+		data, err := os.ReadFile(value[1:])
+		if err != nil {
+			return "", err
+		}
+		return string(data), nil
+	}
+	return value, nil
+}
+
+// personaCommand runs the persona command with the given arguments.
+// Without arguments, it lists the personas. With a name, it makes that
+// persona the current one, or drops the current one if the name is "none".
+func personaCommand(args []string, ui plugin.UI) error {
+	switch {
+	case len(args) == 0:
+		return listPersonas(ui)
+	case len(args) == 1 && args[0] == "none":
+		return configure("persona", "")
+	case len(args) == 1:
+		all, err := personas()
+		if err != nil {
+			return err
+		}
+		if _, ok := all[args[0]]; !ok {
+			return fmt.Errorf("unknown persona %q, type \"persona\" for the list", args[0])
+		}
+		return configure("persona", args[0])
+	}
+	return errors.New("usage: persona [<name> | none]")
+}
+
+// isPersona returns true if name is that of a persona, or "none".
+func isPersona(name string) bool {
+	if name == "none" {
+		return true
+	}
+	all, err := personas()
+	_, ok := all[name]
+	return err == nil && ok
+}
+
+// listPersonas shows the available personas, marking the current one.
+func listPersonas(ui plugin.UI) error {
+	all, err := personas()
+	if err != nil {
+		return err
+	}
+	names := make([]string, 0, len(all))
+	for name := range all {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	current := currentConfig().Persona
+	var lines []string
+	for _, name := range names {
+		mark := " "
+		if name == current {
+			mark = "*"
+		}
+		lines = append(lines, fmt.Sprintf("%s %s", mark, name))
+	}
+	ui.Print(strings.Join(lines, "\n"))
+	return nil
+}
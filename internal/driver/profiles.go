@@ -0,0 +1,237 @@
+// MIT License
+//
+// Copyright (c) 2023 Kevin Herro
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+package driver
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/kevherro/vyx/internal/plugin"
+)
+
+// defaultProfile names the config saved outside of any profile.
+const defaultProfile = "default"
+
+// currentProfileName is the name of the profile the current config
+// belongs to, or empty for the default one. It is guarded by currentCfgMu.
+var currentProfileName string
+
+// currentProfile returns the name of the active profile and the
+// current config.
+func currentProfile() (string, config) {
+	currentCfgMu.Lock()
+	defer currentCfgMu.Unlock()
+	return currentProfileName, currentCfg
+}
+
+// setCurrentProfile makes name the active profile, with cfg as the
+// current config.
+func setCurrentProfile(name string, cfg config) {
+	currentCfgMu.Lock()
+	defer currentCfgMu.Unlock()
+	currentProfileName, currentCfg = name, cfg
+}
+
+// profileName maps the name of a profile given by the user to the
+// name it is stored under in the settings.
+func profileName(name string) (string, error) {
+	switch {
+	case name == defaultProfile:
+		return "", nil
+	case name == "" || strings.ContainsAny(name, " \t=") || isProfileCommand(name):
+		return "", fmt.Errorf("invalid profile name %q", name)
+	}
+	return name, nil
+}
+
+// displayProfileName is the inverse of profileName.
+func displayProfileName(name string) string {
+	if name == "" {
+		return defaultProfile
+	}
+	return name
+}
+
+// switchProfile makes the named profile the active one, replacing
+// the current config with the one saved for the profile.
+func switchProfile(name string) error {
+	name, err := profileName(name)
+	if err != nil {
+		return err
+	}
+	return updateSettings(func(s *settings) (bool, error) {
+		cfg, ok := s.profileConfig(name)
+		if !ok {
+			return false, fmt.Errorf("unknown profile %q", name)
+		}
+		setCurrentProfile(name, cfg)
+		s.Profile = name
+		return true, nil
+	})
+}
+
+// defineProfile saves the current config as the named profile,
+// replacing any existing one, and makes it the active profile.
+func defineProfile(name string) error {
+	name, err := profileName(name)
+	if err != nil {
+		return err
+	}
+	return updateSettings(func(s *settings) (bool, error) {
+		cfg := currentConfig()
+		s.setProfileConfig(name, cfg)
+		setCurrentProfile(name, cfg)
+		s.Profile = name
+		return true, nil
+	})
+}
+
+// copyProfile saves a copy of the profile src under the name dst.
+func copyProfile(src, dst string) error {
+	src, err := profileName(src)
+	if err != nil {
+		return err
+	}
+	if dst, err = profileName(dst); err != nil {
+		return err
+	}
+	return updateSettings(func(s *settings) (bool, error) {
+		cfg, ok := s.profileConfig(src)
+		if !ok {
+			return false, fmt.Errorf("unknown profile %q", src)
+		}
+		s.setProfileConfig(dst, cfg)
+		return true, nil
+	})
+}
+
+// deleteProfile deletes the named profile. If it is the active one,
+// the default profile becomes active.
+func deleteProfile(name string) error {
+	name, err := profileName(name)
+	if err != nil {
+		return err
+	}
+	if name == "" {
+		return fmt.Errorf("the %s profile cannot be deleted", defaultProfile)
+	}
+	return updateSettings(func(s *settings) (bool, error) {
+		if _, ok := s.Profiles[name]; !ok {
+			return false, fmt.Errorf("unknown profile %q", name)
+		}
+		delete(s.Profiles, name)
+		if active, _ := currentProfile(); active == name {
+			setCurrentProfile("", s.Config)
+		}
+		if s.Profile == name {
+			s.Profile = ""
+		}
+		return true, nil
+	})
+}
+
+// isProfileCommand returns true if name is a subcommand of the
+// profile command, which cannot be used as a profile name.
+func isProfileCommand(name string) bool {
+	switch name {
+	case "new", "copy", "delete":
+		return true
+	}
+	return false
+}
+
+// isProfileArgs returns true if args are those of the profile command:
+// none, the name of a saved profile, or a subcommand and its arguments.
+func isProfileArgs(args []string) bool {
+	switch {
+	case len(args) == 0:
+		return true
+	case args[0] == "new":
+		return len(args) == 2
+	case args[0] == "copy":
+		return len(args) == 3 && isSavedProfile(args[1])
+	case args[0] == "delete":
+		return len(args) == 2 && isSavedProfile(args[1])
+	}
+	return len(args) == 1 && isSavedProfile(args[0])
+}
+
+// isSavedProfile returns true if name is that of a saved profile.
+func isSavedProfile(name string) bool {
+	name, err := profileName(name)
+	if err != nil {
+		return false
+	}
+	saved := false
+	updateSettings(func(s *settings) (bool, error) {
+		_, saved = s.profileConfig(name)
+		return false, nil
+	})
+	return saved
+}
+
+// profileCommand runs the profile command with the given arguments.
+// Without arguments, it shows the active profile. With the name of a
+// profile, it switches to it. Otherwise it runs a subcommand.
+func profileCommand(args []string, ui plugin.UI) error {
+	switch {
+	case len(args) == 0:
+		name, _ := currentProfile()
+		ui.Print(displayProfileName(name))
+		return nil
+	case args[0] == "new" && len(args) == 2:
+		return defineProfile(args[1])
+	case args[0] == "copy" && len(args) == 3:
+		return copyProfile(args[1], args[2])
+	case args[0] == "delete" && len(args) == 2:
+		return deleteProfile(args[1])
+	case len(args) == 1 && !isProfileCommand(args[0]):
+		return switchProfile(args[0])
+	}
+	return fmt.Errorf("usage: profile [<name> | new <name> | copy <from> <to> | delete <name>]")
+}
+
+// listProfiles shows the names of the saved profiles, marking the
+// active one.
+func listProfiles(ui plugin.UI) error {
+	return updateSettings(func(s *settings) (bool, error) {
+		names := []string{defaultProfile}
+		for name := range s.Profiles {
+			names = append(names, name)
+		}
+		sort.Strings(names[1:])
+		active, _ := currentProfile()
+		var lines []string
+		for _, name := range names {
+			mark := " "
+			if name == displayProfileName(active) {
+				mark = "*"
+			}
+			lines = append(lines, fmt.Sprintf("%s %s", mark, name))
+		}
+		ui.Print(strings.Join(lines, "\n"))
+		return false, nil
+	})
+}
+
+// prompt returns the prompt of the interactive mode,
+// which shows the active profile, if any.
+func prompt() string {
+	if name, _ := currentProfile(); name != "" {
+		return "(vyx:" + name + ") "
+	}
+	return "(vyx) "
+}
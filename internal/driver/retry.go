@@ -0,0 +1,122 @@
+// MIT License
+//
+// Copyright (c) 2023 Kevin Herro
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+package driver
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Backoff between retries, when the server does not say how long to wait.
+const (
+	initialRetryWait = 500 * time.Millisecond
+	retryJitter      = 0.25 // Fraction of the wait that is randomized.
+)
+
+// retryDelay returns how long to wait before the given attempt to send
+// a request is retried after it failed with err, and false if the
+// request should not be retried. The wait never exceeds maxWait.
+func retryDelay(err error, attempt int, maxWait time.Duration) (time.Duration, bool) {
+	var aerr *apiError
+	if errors.As(err, &aerr) {
+		if !aerr.retryable() {
+			return 0, false
+		}
+		if aerr.retryAfter > 0 {
+			// The server knows best.
+			return aerr.retryAfter, aerr.retryAfter <= maxWait
+		}
+	} else if !isTransient(err) {
+		return 0, false
+	}
+
+	wait := float64(initialRetryWait) * math.Pow(2, float64(attempt-1))
+	wait = math.Min(wait, float64(maxWait))
+	wait *= 1 - retryJitter*rand.Float64()
+	return time.Duration(wait), true
+}
+
+// retryable returns true if the request that failed with e may succeed
+// if it is sent again.
+func (e *apiError) retryable() bool {
+	switch e.shouldRetry {
+	case "true":
+		return true
+	case "false":
+		return false
+	}
+	if e.code == "insufficient_quota" {
+		// Retrying will not add credits.
+		return false
+	}
+	switch e.statusCode {
+	case http.StatusRequestTimeout, http.StatusConflict, http.StatusTooManyRequests:
+		return true
+	}
+	return e.statusCode >= 500
+}
+
+// isTransient returns true if err, returned when sending a request,
+// is caused by a failure of the network that may not happen again.
+func isTransient(err error) bool {
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		return dnsErr.IsTimeout || dnsErr.IsTemporary
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
+
+// parseRetryAfter returns how long the server asks to wait before
+// retrying the request that got a response with the given headers,
+// or 0 if it does not say. If rateLimited, the request can also be
+// retried once the rate limits reset.
+func parseRetryAfter(header http.Header, rateLimited bool) time.Duration {
+	if ms, err := strconv.ParseFloat(header.Get("Retry-After-Ms"), 64); err == nil && ms > 0 {
+		return time.Duration(ms * float64(time.Millisecond))
+	}
+	if v := header.Get("Retry-After"); v != "" {
+		if s, err := strconv.ParseFloat(v, 64); err == nil && s > 0 {
+			return time.Duration(s * float64(time.Second))
+		}
+		if t, err := http.ParseTime(v); err == nil {
+			if d := time.Until(t); d > 0 {
+				return d
+			}
+		}
+	}
+
+	if !rateLimited {
+		return 0
+	}
+	var wait time.Duration
+	for _, h := range []string{"X-Ratelimit-Reset-Requests", "X-Ratelimit-Reset-Tokens"} {
+		if d, err := time.ParseDuration(header.Get(h)); err == nil && d > wait {
+			wait = d
+		}
+	}
+	return wait
+}
+
+// formatWait formats a wait in whole seconds, rounded up.
+func formatWait(d time.Duration) string {
+	return fmt.Sprintf("%.0fs", math.Ceil(d.Seconds()))
+}
@@ -0,0 +1,115 @@
+// MIT License
+//
+// Copyright (c) 2023 Kevin Herro
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+package driver
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// maxStopSequences is the most stop sequences the API accepts.
+const maxStopSequences = 4
+
+// parseStop parses the value of the stop config field: a comma-separated
+// list of stop sequences, where "\," stands for a comma, "\n" for a
+// newline, "\t" for a tab and "\\" for a backslash.
+func parseStop(value string) ([]string, error) {
+	if value == "" {
+		return nil, nil
+	}
+	var stops []string
+	var b strings.Builder
+	for i := 0; i < len(value); i++ {
+		c := value[i]
+		switch {
+		case c == ',':
+			stops = append(stops, b.String())
+			b.Reset()
+			continue
+		case c != '\\':
+			b.WriteByte(c)
+			continue
+		case i+1 == len(value):
+			return nil, errors.New("trailing backslash")
+		}
+		i++
+		switch value[i] {
+		case ',', '\\':
+			b.WriteByte(value[i])
+		case 'n':
+			b.WriteByte('\n')
+		case 't':
+			b.WriteByte('\t')
+		default:
+			return nil, fmt.Errorf("unknown escape sequence \\%c", value[i])
+		}
+	}
+	stops = append(stops, b.String())
+	for _, s := range stops {
+		if s == "" {
+			return nil, errors.New("empty stop sequence")
+		}
+	}
+	if len(stops) > maxStopSequences {
+		return nil, fmt.Errorf("at most %d stop sequences are allowed", maxStopSequences)
+	}
+	return stops, nil
+}
+
+// parseLogitBias parses the value of the logit_bias config field: a
+// comma-separated list of token:bias pairs, where token is a token ID
+// and bias an integer between -100 and 100.
+func parseLogitBias(value string) (map[string]int, error) {
+	if value == "" {
+		return nil, nil
+	}
+	bias := map[string]int{}
+	for _, pair := range strings.Split(value, ",") {
+		token, b, ok := strings.Cut(strings.TrimSpace(pair), ":")
+		if !ok {
+			return nil, fmt.Errorf("%q is not of the form token:bias", pair)
+		}
+		if _, err := strconv.ParseUint(token, 10, 32); err != nil {
+			return nil, fmt.Errorf("invalid token ID %q", token)
+		}
+		v, err := strconv.Atoi(b)
+		if err != nil || v < -100 || v > 100 {
+			return nil, fmt.Errorf("invalid bias %q, want an integer between -100 and 100", b)
+		}
+		bias[token] = v
+	}
+	return bias, nil
+}
+
+// sampling holds the sampling parameters of cfg that need parsing.
+type sampling struct {
+	stop      []string
+	logitBias map[string]int
+}
+
+// samplingOf parses the sampling parameters of cfg.
+func samplingOf(cfg config) (sampling, error) {
+	var s sampling
+	var err error
+	if s.stop, err = parseStop(cfg.Stop); err != nil {
+		return s, fmt.Errorf("invalid stop: %v", err)
+	}
+	if s.logitBias, err = parseLogitBias(cfg.LogitBias); err != nil {
+		return s, fmt.Errorf("invalid logit_bias: %v", err)
+	}
+	return s, nil
+}
@@ -0,0 +1,74 @@
+// MIT License
+//
+// Copyright (c) 2023 Kevin Herro
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+package driver
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseStop(t *testing.T) {
+	for _, tc := range []struct {
+		value string
+		want  []string
+		err   string
+	}{
+		{value: "", want: nil},
+		{value: "END", want: []string{"END"}},
+		{value: `a,b\,c,\n\n`, want: []string{"a", "b,c", "\n\n"}},
+		{value: `back\\slash`, want: []string{`back\slash`}},
+		{value: "a,,b", err: "empty stop sequence"},
+		{value: `a\`, err: "trailing backslash"},
+		{value: `\x`, err: `unknown escape sequence \x`},
+		{value: "a,b,c,d,e", err: "at most 4 stop sequences"},
+	} {
+		got, err := parseStop(tc.value)
+		switch {
+		case tc.err != "":
+			if err == nil || !strings.Contains(err.Error(), tc.err) {
+				t.Errorf("parseStop(%q) returned error %v, want %q", tc.value, err, tc.err)
+			}
+		case err != nil:
+			t.Errorf("parseStop(%q): %v", tc.value, err)
+		case !reflect.DeepEqual(got, tc.want):
+			t.Errorf("parseStop(%q) = %q, want %q", tc.value, got, tc.want)
+		}
+	}
+}
+
+func TestSamplingRequest(t *testing.T) {
+	srv, ui := runInteractive(t, nil, "hello", "top_p=0.9", `stop=\n\n,END`,
+		"logit_bias=50256:-100", "json_object", "logit_bias=oops", "hello")
+	if got, want := ui.errs.String(), `invalid "logit_bias" value "oops"`; !strings.Contains(got, want) {
+		t.Errorf("got errors\n%s\nwant them to contain %q", got, want)
+	}
+
+	reqs := srv.Requests()
+	if len(reqs) != 2 {
+		t.Fatalf("got %d requests, want 2", len(reqs))
+	}
+	for _, param := range []string{"top_p", "n", "stop", "seed", "logit_bias", "user", "response_format"} {
+		if strings.Contains(string(reqs[0].Body), `"`+param+`":`) {
+			t.Errorf("unset %s sent: %s", param, reqs[0].Body)
+		}
+	}
+	for _, want := range []string{`"top_p":0.9`, `"stop":["\n\n","END"]`, `"logit_bias":{"50256":-100}`,
+		`"response_format":{"type":"json_object"}`} {
+		if !strings.Contains(string(reqs[1].Body), want) {
+			t.Errorf("request does not contain %s: %s", want, reqs[1].Body)
+		}
+	}
+}
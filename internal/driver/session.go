@@ -0,0 +1,356 @@
+// MIT License
+//
+// Copyright (c) 2023 Kevin Herro
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+package driver
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/kevherro/vyx/internal/api/chat"
+	"github.com/kevherro/vyx/internal/plugin"
+)
+
+// session is a conversation saved on disk, so that it can be resumed
+// after vyx exits.
+type session struct {
+	ID       string         `json:"id"`
+	Title    string         `json:"title"`
+	Created  time.Time      `json:"created"`
+	Updated  time.Time      `json:"updated"`
+	Config   config         `json:"config"` // The config of the last request.
+	Messages []chat.Message `json:"messages"`
+}
+
+// maxTitleLength is the length titles derived from prompts are cut to.
+const maxTitleLength = 60
+
+// dataDir returns the directory where vyx keeps its data,
+// $XDG_DATA_HOME/vyx or ~/.local/share/vyx.
+func dataDir() (string, error) {
+	dir := os.Getenv("XDG_DATA_HOME")
+	if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", fmt.Errorf("failed to get data directory: %w", err)
+		}
+		dir = filepath.Join(home, ".local", "share")
+	}
+	return filepath.Join(dir, "vyx"), nil
+}
+
+// sessionsDir returns the directory where sessions are saved.
+func sessionsDir() (string, error) {
+	dir, err := dataDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "sessions"), nil
+}
+
+// sessionFileName returns the name of the file holding session id.
+func sessionFileName(id string) (string, error) {
+	dir, err := sessionsDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, id+".json"), nil
+}
+
+// newSessionID returns a random ID for a new session.
+func newSessionID() string {
+	var b [4]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b[:])
+}
+
+// newSession returns a session for a conversation starting now.
+func newSession() *session {
+	now := time.Now()
+	return &session{ID: newSessionID(), Created: now, Updated: now}
+}
+
+// readSession reads the session saved in fname.
+func readSession(fname string) (*session, error) {
+	data, err := os.ReadFile(fname)
+	if err != nil {
+		return nil, err
+	}
+	s := &session{Config: defaultConfig()}
+	if err := json.Unmarshal(data, s); err != nil {
+		return nil, fmt.Errorf("could not parse session in %s: %w", fname, err)
+	}
+	return s, nil
+}
+
+// write saves s in its file. Sessions are only readable by their
+// owner, as conversations are often private.
+func (s *session) write() error {
+	fname, err := sessionFileName(s.ID)
+	if err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return fmt.Errorf("could not encode session: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(fname), 0700); err != nil {
+		return fmt.Errorf("failed to create sessions directory: %w", err)
+	}
+	if err := os.WriteFile(fname, append(data, '\n'), 0600); err != nil {
+		return fmt.Errorf("failed to write session: %w", err)
+	}
+	return nil
+}
+
+// listSessions returns the saved sessions, most recently updated first.
+func listSessions() ([]*session, error) {
+	dir, err := sessionsDir()
+	if err != nil {
+		return nil, err
+	}
+	fnames, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	var sessions []*session
+	for _, fname := range fnames {
+		s, err := readSession(fname)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, s)
+	}
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].Updated.After(sessions[j].Updated)
+	})
+	return sessions, nil
+}
+
+// findSession returns the saved session whose ID is or starts with id.
+func findSession(id string) (*session, error) {
+	sessions, err := listSessions()
+	if err != nil {
+		return nil, err
+	}
+	var found *session
+	for _, s := range sessions {
+		switch {
+		case s.ID == id:
+			return s, nil
+		case strings.HasPrefix(s.ID, id):
+			if found != nil {
+				return nil, fmt.Errorf("ambiguous session ID %q", id)
+			}
+			found = s
+		}
+	}
+	if found == nil {
+		return nil, fmt.Errorf("unknown session %q, type \"sessions\" for the list", id)
+	}
+	return found, nil
+}
+
+// deleteSession deletes the saved session s.
+func deleteSession(s *session) error {
+	fname, err := sessionFileName(s.ID)
+	if err != nil {
+		return err
+	}
+	return os.Remove(fname)
+}
+
+// titleFor returns a title for a conversation made of messages,
+// taken from the first line of its first prompt.
+func titleFor(messages []chat.Message) string {
+	for _, m := range messages {
+		if m.Role != chat.RoleUser {
+			continue
+		}
+		title := strings.Join(strings.Fields(strings.SplitN(strings.TrimSpace(m.Content), "\n", 2)[0]), " ")
+		if utf8.RuneCountInString(title) > maxTitleLength {
+			title = string([]rune(title)[:maxTitleLength-3]) + "..."
+		}
+		return title
+	}
+	return ""
+}
+
+// saveSession saves the conversation of sh as its current session,
+// starting one if needed. Empty conversations are not saved.
+func (sh *shell) saveSession() error {
+	if len(sh.conv.messages) == 0 {
+		return nil
+	}
+	if sh.session == nil {
+		sh.session = newSession()
+	}
+	s := sh.session
+	if s.Title == "" {
+		s.Title = titleFor(sh.conv.messages)
+	}
+	s.Updated = time.Now()
+	s.Config = currentConfig()
+	s.Messages = sh.conv.messages
+	return s.write()
+}
+
+// isSessionArgs returns true if args are those of the session command:
+// none, or a subcommand followed by the ID of a saved session and, to
+// rename it, a title. Only sessions to resume can be abbreviated.
+func isSessionArgs(args []string) bool {
+	switch {
+	case len(args) == 0:
+		return true
+	case args[0] == "resume":
+		return len(args) == 2 && isSessionID(args[1], false)
+	case args[0] == "rename":
+		return len(args) >= 3 && isSessionID(args[1], true)
+	case args[0] == "delete":
+		return len(args) == 2 && isSessionID(args[1], true)
+	}
+	return false
+}
+
+// isSessionSubcommand returns true if name is a subcommand of the
+// session command.
+func isSessionSubcommand(name string) bool {
+	switch name {
+	case "resume", "rename", "delete":
+		return true
+	}
+	return false
+}
+
+// sessionCommand runs the session command with the given arguments.
+// Without arguments, it shows the current session. Otherwise it runs
+// a subcommand.
+func (sh *shell) sessionCommand(args []string) error {
+	switch {
+	case len(args) == 0:
+		if sh.session == nil {
+			sh.o.UI.Print("the conversation is not saved yet")
+			return nil
+		}
+		sh.o.UI.Print(sh.session.ID, "  ", sh.session.Title)
+		return nil
+	case args[0] == "resume" && len(args) == 2:
+		return sh.resumeSession(args[1])
+	case args[0] == "rename" && len(args) >= 3:
+		return sh.renameSession(args[1:])
+	case args[0] == "delete" && len(args) == 2:
+		return sh.deleteSessionCommand(args[1])
+	}
+	return errors.New("usage: session [resume <id> | rename <id> <title> | delete <id>]")
+}
+
+// resumeSession makes the saved session with the given ID the current
+// one, restoring its conversation and config.
+func (sh *shell) resumeSession(id string) error {
+	s, err := findSession(id)
+	if err != nil {
+		return err
+	}
+	sh.session = s
+	sh.conv.messages = s.Messages
+	setCurrentConfig(s.Config)
+	sh.o.UI.Print(fmt.Sprintf("resumed session %s: %s (%d messages)", s.ID, s.Title, len(s.Messages)))
+	return nil
+}
+
+// renameSession changes the title of the saved session whose ID is
+// args[0] to the rest of args. The ID must be given in full.
+func (sh *shell) renameSession(args []string) error {
+	s, err := exactSession(args[0])
+	if err != nil {
+		return err
+	}
+	if sh.session != nil && s.ID == sh.session.ID {
+		s = sh.session
+	}
+	s.Title = strings.Join(args[1:], " ")
+	return s.write()
+}
+
+// deleteSessionCommand deletes the saved session whose ID is id, which
+// must be given in full. The conversation of the current session is
+// kept, and saved as a new session if it continues.
+func (sh *shell) deleteSessionCommand(id string) error {
+	s, err := exactSession(id)
+	if err != nil {
+		return err
+	}
+	if err := deleteSession(s); err != nil {
+		return err
+	}
+	if sh.session != nil && s.ID == sh.session.ID {
+		sh.session = nil
+	}
+	return nil
+}
+
+// isSessionID returns true if id is the ID of a saved session or, unless
+// exact is set, a prefix of one.
+func isSessionID(id string, exact bool) bool {
+	find := findSession
+	if exact {
+		find = exactSession
+	}
+	_, err := find(id)
+	return err == nil
+}
+
+// exactSession returns the saved session whose ID is id. Unlike
+// findSession, it does not accept prefixes of IDs.
+func exactSession(id string) (*session, error) {
+	s, err := findSession(id)
+	if err == nil && s.ID != id {
+		err = fmt.Errorf("unknown session %q, give the full ID", id)
+	}
+	return s, err
+}
+
+// printSessions shows the saved sessions, marking the current one.
+func printSessions(ui plugin.UI, current *session) error {
+	sessions, err := listSessions()
+	if err != nil {
+		return err
+	}
+	if len(sessions) == 0 {
+		ui.Print("no saved sessions")
+		return nil
+	}
+	var lines []string
+	for _, s := range sessions {
+		mark := " "
+		if current != nil && s.ID == current.ID {
+			mark = "*"
+		}
+		lines = append(lines, fmt.Sprintf("%s %s  %s  %3d  %s", mark, s.ID,
+			s.Updated.Local().Format("2006-01-02 15:04"), len(s.Messages), s.Title))
+	}
+	ui.Print(strings.Join(lines, "\n"))
+	return nil
+}
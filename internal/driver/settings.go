@@ -0,0 +1,206 @@
+// MIT License
+//
+// Copyright (c) 2023 Kevin Herro
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+package driver
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// settings holds vyx settings saved in a JSON file.
+type settings struct {
+	// Config holds the config values saved outside of any profile.
+	Config config `json:"config"`
+
+	// Profiles holds named configs, keyed by name.
+	Profiles map[string]config `json:"profiles,omitempty"`
+
+	// Profile is the name of the active profile, empty for Config.
+	Profile string `json:"profile,omitempty"`
+
+	// Pricing holds the prices of models, keyed by model ID. They
+	// take precedence over the built-in ones.
+	Pricing map[string]price `json:"pricing,omitempty"`
+
+	// Personas holds the system messages of personas, keyed by name.
+	// They take precedence over the built-in ones.
+	Personas map[string]string `json:"personas,omitempty"`
+}
+
+// profileConfig returns the config of the named profile,
+// or Config if name is empty.
+func (s *settings) profileConfig(name string) (config, bool) {
+	if name == "" {
+		return s.Config, true
+	}
+	cfg, ok := s.Profiles[name]
+	return cfg, ok
+}
+
+// setProfileConfig stores cfg as the config of the named profile,
+// or as Config if name is empty.
+func (s *settings) setProfileConfig(name string, cfg config) {
+	if name == "" {
+		s.Config = cfg
+		return
+	}
+	if s.Profiles == nil {
+		s.Profiles = map[string]config{}
+	}
+	s.Profiles[name] = cfg
+}
+
+// MarshalJSON encodes the saved fields of c whose values differ from
+// their defaults. Values missing from the encoding keep their defaults
+// when decoded, so that changes to the defaults carry over.
+func (c config) MarshalJSON() ([]byte, error) {
+	m := map[string]any{}
+	for _, f := range configFields {
+		if f.saved && c.get(f) != f.defaultValue {
+			m[f.name] = c.fieldPtr(f)
+		}
+	}
+	return json.Marshal(m)
+}
+
+// UnmarshalJSON decodes the encoding of a config by MarshalJSON.
+// Fields missing from data are set to their defaults.
+func (c *config) UnmarshalJSON(data []byte) error {
+	type plain config // Has no UnmarshalJSON method.
+	p := plain(defaultConfig())
+	if err := json.Unmarshal(data, &p); err != nil {
+		return err
+	}
+	*c = config(p)
+	return nil
+}
+
+// settingsFileName returns the name of the file where settings are saved.
+func settingsFileName() (string, error) {
+	// os.UserConfigDir honors $XDG_CONFIG_HOME.
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	if dir == "" {
+		return "", fmt.Errorf("failed to get settings directory")
+	}
+	return filepath.Join(dir, "vyx", "settings.json"), nil
+}
+
+// readSettings reads settings from fname. Config values that are not
+// in the file keep their defaults. A missing file holds no settings.
+func readSettings(fname string) (*settings, error) {
+	s := &settings{Config: defaultConfig()}
+	data, err := os.ReadFile(fname)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return s, nil
+		}
+		return nil, fmt.Errorf("could not read settings: %w", err)
+	}
+	if err := json.Unmarshal(data, s); err != nil {
+		return nil, fmt.Errorf("could not parse settings in %s: %w", fname, err)
+	}
+	return s, nil
+}
+
+// writeSettings saves settings to fname.
+func writeSettings(fname string, s *settings) error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return fmt.Errorf("could not encode settings: %w", err)
+	}
+
+	// create the settings directory if it does not exist
+	// XDG specifies permissions 0700 when creating settings dirs:
+	// https://specifications.freedesktop.org/basedir-spec/basedir-spec-latest.html
+	if err := os.MkdirAll(filepath.Dir(fname), 0700); err != nil {
+		return fmt.Errorf("failed to create settings directory: %w", err)
+	}
+
+	if err := os.WriteFile(fname, append(data, '\n'), 0644); err != nil {
+		return fmt.Errorf("failed to write settings: %w", err)
+	}
+	return nil
+}
+
+// loadSettings replaces the current config with the one saved in the
+// settings file for the active profile.
+func loadSettings() error {
+	return updateSettings(func(s *settings) (bool, error) {
+		cfg, ok := s.profileConfig(s.Profile)
+		if !ok {
+			// The profile is gone, use the config saved outside of profiles.
+			s.Profile = ""
+			cfg = s.Config
+		}
+		setCurrentProfile(s.Profile, cfg)
+		return false, nil
+	})
+}
+
+// saveSettings saves the current config to the settings file,
+// as the config of the active profile.
+func saveSettings() (string, error) {
+	fname, err := settingsFileName()
+	if err != nil {
+		return "", err
+	}
+	return fname, updateSettings(func(s *settings) (bool, error) {
+		name, cfg := currentProfile()
+		s.setProfileConfig(name, cfg)
+		s.Profile = name
+		return true, nil
+	})
+}
+
+// updateSettings reads the settings file and calls f with its contents.
+// If f returns true, the settings are written back.
+func updateSettings(f func(s *settings) (bool, error)) error {
+	fname, err := settingsFileName()
+	if err != nil {
+		return err
+	}
+	s, err := readSettings(fname)
+	if err != nil {
+		return err
+	}
+	write, err := f(s)
+	if err != nil || !write {
+		return err
+	}
+	return writeSettings(fname, s)
+}
+
+// envPrefix is prepended to the upper-cased name of a config field
+// to get the environment variable that sets it, e.g. VYX_TEMPERATURE.
+const envPrefix = "VYX_"
+
+// configureFromEnv assigns config fields from the environment.
+func configureFromEnv() error {
+	for _, f := range configFields {
+		env := envPrefix + strings.ToUpper(f.name)
+		if value, ok := os.LookupEnv(env); ok {
+			if err := configure(f.name, value); err != nil {
+				return fmt.Errorf("%s: %v", env, err)
+			}
+		}
+	}
+	return nil
+}
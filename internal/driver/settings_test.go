@@ -0,0 +1,128 @@
+// MIT License
+//
+// Copyright (c) 2023 Kevin Herro
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+package driver
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestConfigJSON(t *testing.T) {
+	data, err := json.Marshal(defaultConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "{}" {
+		t.Errorf("default config encoded as %s, want {}", data)
+	}
+
+	// Zero values that differ from the defaults are kept, even if the
+	// fields are tagged omitempty.
+	cfg := defaultConfig()
+	cfg.Temperature = 0
+	cfg.History = false
+	cfg.Stop = "END"
+	cfg.Output = "reply.txt"
+	if data, err = json.Marshal(cfg); err != nil {
+		t.Fatal(err)
+	}
+	var fields map[string]any
+	if err := json.Unmarshal(data, &fields); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]any{"temperature": 0.0, "history": false, "stop": "END"}
+	if !reflect.DeepEqual(fields, want) {
+		t.Errorf("config encoded as %s, want the fields %v", data, want)
+	}
+
+	var got config
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatal(err)
+	}
+	cfg.Output = "" // Not saved.
+	if got != cfg {
+		t.Errorf("decoded %+v, want %+v", got, cfg)
+	}
+}
+
+func TestProfiles(t *testing.T) {
+	_, ui, o := setup(t, nil)
+	sh := &shell{o: o, conv: &conversation{}}
+	ctx := context.Background()
+
+	for _, step := range []struct {
+		input       string
+		profile     string // The active profile afterwards.
+		temperature float64
+		stop        string
+		err         string // An error shown by the command.
+	}{
+		{input: "temperature=0", temperature: 0},
+		{input: "save", temperature: 0},
+		{input: "profile new work", profile: "work", temperature: 0},
+		{input: "stop=END", profile: "work", temperature: 0, stop: "END"},
+		{input: "save", profile: "work", temperature: 0, stop: "END"},
+		{input: "temperature=1.5", profile: "work", temperature: 1.5, stop: "END"},
+		{input: "load", profile: "work", temperature: 0, stop: "END"},
+		{input: "profile copy work play", profile: "work", temperature: 0, stop: "END"},
+		{input: "profile default", temperature: 0},
+		{input: "profile play", profile: "play", temperature: 0, stop: "END"},
+		{input: "profile delete play", temperature: 0},
+		{input: "profile play", temperature: 0}, // A prompt, as play is gone.
+		{input: "profile delete default", temperature: 0, err: "the default profile cannot be deleted"},
+		{input: "profile new copy", temperature: 0, err: `invalid profile name "copy"`},
+	} {
+		ui.errs.Reset()
+		if err := sh.execute(ctx, step.input); err != nil {
+			t.Fatalf("%s: %v", step.input, err)
+		}
+		if got := ui.errs.String(); step.err == "" && got != "" || !strings.Contains(got, step.err) {
+			t.Errorf("%s: got errors %q, want %q", step.input, got, step.err)
+		}
+		name, cfg := currentProfile()
+		if name != step.profile || cfg.Temperature != step.temperature || cfg.Stop != step.stop {
+			t.Errorf("%s: got profile %q with temperature=%v stop=%q, want %q with temperature=%v stop=%q",
+				step.input, name, cfg.Temperature, cfg.Stop, step.profile, step.temperature, step.stop)
+		}
+	}
+
+	fname, err := settingsFileName()
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(fname)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var s struct {
+		Config   map[string]any
+		Profiles map[string]map[string]any
+		Profile  string
+	}
+	if err := json.Unmarshal(data, &s); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]any{"temperature": 0.0}
+	if !reflect.DeepEqual(s.Config, want) || s.Profile != "" || len(s.Profiles) != 1 {
+		t.Fatalf("saved settings\n%s\nwant a default config of %v and only the work profile", data, want)
+	}
+	if want := map[string]any{"temperature": 0.0, "stop": "END"}; !reflect.DeepEqual(s.Profiles["work"], want) {
+		t.Errorf("saved work profile %v, want %v", s.Profiles["work"], want)
+	}
+}
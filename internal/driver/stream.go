@@ -0,0 +1,257 @@
+// MIT License
+//
+// Copyright (c) 2023 Kevin Herro
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+package driver
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/kevherro/vyx/internal/api/chat"
+	"github.com/kevherro/vyx/internal/api/completions"
+	"github.com/kevherro/vyx/internal/api/sse"
+	"github.com/kevherro/vyx/internal/plugin"
+)
+
+// errIncomplete is returned when a stream ends before the reply does,
+// typically because the connection was dropped.
+var errIncomplete = errors.New("connection closed before the reply was complete")
+
+// streamChat sends payload to the chat endpoint and shows the reply
+// on the UI as it arrives.
+func streamChat(ctx context.Context, o *plugin.Options, payload *chat.Request) (*apiReply, error) {
+	return streamReply(ctx, o, chat.Method, chat.Path, payload,
+		func(data []byte) (delta, error) {
+			var chunk struct {
+				chat.Chunk
+				Error *apiErrorBody `json:"error"`
+			}
+			if err := json.Unmarshal(data, &chunk); err != nil {
+				return delta{}, err
+			}
+			if chunk.Error != nil {
+				return delta{}, newAPIError(0, nil, chunk.Error)
+			}
+			d := delta{usage: chunk.Usage}
+			if len(chunk.Choices) > 0 {
+				c := chunk.Choices[0]
+				d.text, d.finish = c.Delta.Content, c.FinishReason
+			}
+			return d, nil
+		},
+		func(data []byte) (*apiReply, error) {
+			var r chat.Response
+			if err := json.Unmarshal(data, &r); err != nil {
+				return nil, err
+			}
+			return chatReply(&r)
+		})
+}
+
+// streamCompletion sends payload to the completions endpoint and shows
+// the reply on the UI as it arrives.
+func streamCompletion(ctx context.Context, o *plugin.Options, payload *completions.Request) (*apiReply, error) {
+	parse := func(data []byte) (delta, error) {
+		var r struct {
+			completions.Response
+			Error *apiErrorBody `json:"error"`
+		}
+		if err := json.Unmarshal(data, &r); err != nil {
+			return delta{}, err
+		}
+		if r.Error != nil {
+			return delta{}, newAPIError(0, nil, r.Error)
+		}
+		var d delta
+		if r.Usage.TotalTokens > 0 {
+			u := chat.Usage(r.Usage)
+			d.usage = &u
+		}
+		if len(r.Choices) > 0 {
+			c := r.Choices[0]
+			d.text, d.finish = c.Text, c.FinishReason
+		}
+		return d, nil
+	}
+	return streamReply(ctx, o, completions.Method, completions.Path, payload, parse,
+		func(data []byte) (*apiReply, error) {
+			var r completions.Response
+			if err := json.Unmarshal(data, &r); err != nil {
+				return nil, err
+			}
+			return completionReply(&r)
+		})
+}
+
+// delta is what an event of a stream adds to the reply.
+type delta struct {
+	text   string      // Text added to the reply.
+	finish string      // Why the reply finished, once it has.
+	usage  *chat.Usage // Usage for the whole request, once known.
+}
+
+// streamReply sends payload to the endpoint at path and shows the
+// streamed reply on the UI as it arrives. The data of each event is decoded
+// by parse into what the event adds to the reply. Servers that answer with a
+// regular response instead of a stream have it decoded by whole.
+// If ctx is canceled during the stream, the part of the reply received
+// so far is returned.
+func streamReply(ctx context.Context, o *plugin.Options, method, path string, payload any,
+	parse func(data []byte) (delta, error),
+	whole func(data []byte) (*apiReply, error)) (*apiReply, error) {
+	resp, err := do(ctx, o, method, path, payload)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	p := newDeltaPrinter(o.UI)
+	defer p.done()
+
+	if !isEventStream(resp) {
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return nil, err
+		}
+		var e struct {
+			Error *apiErrorBody `json:"error"`
+		}
+		if json.Unmarshal(body, &e) == nil && e.Error != nil {
+			return nil, newAPIError(resp.StatusCode, resp.Header, e.Error)
+		}
+		reply, err := whole(body)
+		if err != nil {
+			return nil, err
+		}
+		p.print(reply.Text)
+		return reply, nil
+	}
+
+	var text strings.Builder
+	var finishReason string
+	var usage chat.Usage
+	err = readStream(resp.Body, func(data []byte) error {
+		d, err := parse(data)
+		if err != nil {
+			return err
+		}
+		p.print(d.text)
+		text.WriteString(d.text)
+		if d.finish != "" {
+			finishReason = d.finish
+		}
+		if d.usage != nil {
+			usage = *d.usage
+		}
+		return nil
+	})
+	if err == errIncomplete && finishReason != "" {
+		// Some servers close the stream without sending [DONE].
+		err = nil
+	}
+	if err != nil && ctx.Err() != nil {
+		if text.Len() == 0 {
+			return nil, errCanceled
+		}
+		// Keep what was received before the interruption.
+		return &apiReply{Text: text.String(), FinishReason: finishInterrupted}, nil
+	}
+	if e, ok := err.(*apiError); ok && e.requestID == "" {
+		e.requestID = resp.Header.Get("X-Request-Id")
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &apiReply{Text: text.String(), FinishReason: finishReason, Usage: usage}, nil
+}
+
+// isEventStream returns true if resp holds server-sent events.
+func isEventStream(resp *http.Response) bool {
+	t, _, err := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	return err == nil && t == "text/event-stream"
+}
+
+// readStream decodes the server-sent events in r and calls f with the
+// data of each of them, until the end of the stream is signaled. It
+// returns errIncomplete if r ends before that.
+func readStream(r io.Reader, f func(data []byte) error) error {
+	d := sse.NewDecoder(r)
+	for {
+		ev, err := d.Next()
+		switch err {
+		case nil:
+		case io.EOF, io.ErrUnexpectedEOF:
+			return errIncomplete
+		default:
+			return err
+		}
+		if ev.Data == sse.Done {
+			return nil
+		}
+		if err := f([]byte(ev.Data)); err != nil {
+			return err
+		}
+	}
+}
+
+// deltaPrinter shows the pieces of a streamed reply on a UI.
+// UIs that cannot show partial messages are given whole lines instead.
+type deltaPrinter struct {
+	ui      plugin.UI
+	partial plugin.StreamUI // Set if ui can show partial messages.
+	line    strings.Builder // Pending incomplete line, if partial is nil.
+	open    bool            // Whether a partial line was shown.
+}
+
+func newDeltaPrinter(ui plugin.UI) *deltaPrinter {
+	p := &deltaPrinter{ui: ui}
+	p.partial, _ = ui.(plugin.StreamUI)
+	return p
+}
+
+// print shows s, a piece of the reply.
+func (p *deltaPrinter) print(s string) {
+	if s == "" {
+		return
+	}
+	if p.partial != nil {
+		p.partial.PrintPartial(s)
+		p.open = !strings.HasSuffix(s, "\n")
+		return
+	}
+	p.line.WriteString(s)
+	text := p.line.String()
+	if i := strings.LastIndexByte(text, '\n'); i != -1 {
+		p.ui.Print(text[:i+1])
+		p.line.Reset()
+		p.line.WriteString(text[i+1:])
+	}
+}
+
+// done terminates the reply, showing whatever is pending.
+func (p *deltaPrinter) done() {
+	if p.open {
+		p.partial.PrintPartial("\n")
+		p.open = false
+	}
+	if p.line.Len() > 0 {
+		p.ui.Print(p.line.String())
+		p.line.Reset()
+	}
+}
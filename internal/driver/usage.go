@@ -0,0 +1,326 @@
+// MIT License
+//
+// Copyright (c) 2023 Kevin Herro
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+package driver
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"text/tabwriter"
+
+	"github.com/kevherro/vyx/internal/api/chat"
+	"github.com/kevherro/vyx/internal/plugin"
+)
+
+// price is the price of a model, in USD per million tokens.
+type price struct {
+	Prompt     float64 `json:"prompt"`
+	Completion float64 `json:"completion"`
+}
+
+// cost returns the cost of the tokens in u.
+func (p price) cost(u chat.Usage) float64 {
+	return (float64(u.PromptTokens)*p.Prompt + float64(u.CompletionTokens)*p.Completion) / 1e6
+}
+
+// defaultPricing holds the prices of common models. Prices set in the
+// settings file take precedence.
+var defaultPricing = map[string]price{
+	"gpt-4o":        {Prompt: 2.50, Completion: 10.00},
+	"gpt-4o-mini":   {Prompt: 0.15, Completion: 0.60},
+	"gpt-4.1":       {Prompt: 2.00, Completion: 8.00},
+	"gpt-4.1-mini":  {Prompt: 0.40, Completion: 1.60},
+	"gpt-4.1-nano":  {Prompt: 0.10, Completion: 0.40},
+	"gpt-4-turbo":   {Prompt: 10.00, Completion: 30.00},
+	"gpt-4":         {Prompt: 30.00, Completion: 60.00},
+	"gpt-3.5-turbo": {Prompt: 0.50, Completion: 1.50},
+	"o1":            {Prompt: 15.00, Completion: 60.00},
+	"o1-mini":       {Prompt: 1.10, Completion: 4.40},
+	"o3":            {Prompt: 2.00, Completion: 8.00},
+	"o3-mini":       {Prompt: 1.10, Completion: 4.40},
+	"o4-mini":       {Prompt: 1.10, Completion: 4.40},
+}
+
+// pricing returns the prices set in the settings file.
+func pricing() (map[string]price, error) {
+	var custom map[string]price
+	err := updateSettings(func(s *settings) (bool, error) {
+		custom = s.Pricing
+		return false, nil
+	})
+	return custom, err
+}
+
+// priceOf returns the price of model, and false if it is unknown.
+func priceOf(model string) (price, bool, error) {
+	custom, err := pricing()
+	if err != nil {
+		return price{}, false, err
+	}
+	for _, table := range []map[string]price{custom, defaultPricing} {
+		if p, ok := lookupByModel(table, model); ok {
+			return p, true, nil
+		}
+	}
+	return price{}, false, nil
+}
+
+// setPrice saves the price of model in the settings file.
+func setPrice(model string, p price) error {
+	return updateSettings(func(s *settings) (bool, error) {
+		if s.Pricing == nil {
+			s.Pricing = map[string]price{}
+		}
+		s.Pricing[model] = p
+		return true, nil
+	})
+}
+
+// pricingCommand runs the pricing command with the given arguments.
+// Without arguments, it shows the prices. Otherwise it sets the price
+// of a model.
+func pricingCommand(args []string, ui plugin.UI) error {
+	switch len(args) {
+	case 0:
+		return listPrices(ui)
+	case 3:
+		var p price
+		var err error
+		if p.Prompt, err = strconv.ParseFloat(args[1], 64); err != nil || p.Prompt < 0 {
+			return fmt.Errorf("invalid prompt price %q", args[1])
+		}
+		if p.Completion, err = strconv.ParseFloat(args[2], 64); err != nil || p.Completion < 0 {
+			return fmt.Errorf("invalid completion price %q", args[2])
+		}
+		return setPrice(args[0], p)
+	}
+	return errors.New("usage: pricing [<model> <prompt> <completion>]")
+}
+
+// isPriceArgs returns true if args are those of the pricing command:
+// none, or a model followed by two prices.
+func isPriceArgs(args []string) bool {
+	if len(args) == 0 {
+		return true
+	}
+	for _, arg := range args[1:] {
+		if _, err := strconv.ParseFloat(arg, 64); err != nil {
+			return false
+		}
+	}
+	return len(args) == 3
+}
+
+// listPrices shows the price of every model with one.
+func listPrices(ui plugin.UI) error {
+	custom, err := pricing()
+	if err != nil {
+		return err
+	}
+	table := map[string]price{}
+	for _, t := range []map[string]price{defaultPricing, custom} {
+		for id, p := range t {
+			table[id] = p
+		}
+	}
+	ids := make([]string, 0, len(table))
+	for id := range table {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	var b strings.Builder
+	w := newTableWriter(&b, ids)
+	fmt.Fprintf(w, "%-*s\tprompt\tcompletion\t\n", w.width, "model")
+	for _, id := range ids {
+		p := table[id]
+		fmt.Fprintf(w, "%-*s\t$%.2f\t$%.2f\t\n", w.width, id, p.Prompt, p.Completion)
+	}
+	w.Flush()
+	ui.Print(b.String() + "Prices are in USD per million tokens.")
+	return nil
+}
+
+// tableWriter aligns the columns of a table of models, right-aligning
+// all but the first one, which holds model IDs.
+type tableWriter struct {
+	*tabwriter.Writer
+	width int // Width of the first column.
+}
+
+// newTableWriter returns a tableWriter writing to b a table of
+// the models in ids.
+func newTableWriter(b *strings.Builder, ids []string) *tableWriter {
+	w := &tableWriter{Writer: tabwriter.NewWriter(b, 0, 0, 2, ' ', tabwriter.AlignRight)}
+	w.width = len("model")
+	for _, id := range ids {
+		if len(id) > w.width {
+			w.width = len(id)
+		}
+	}
+	return w
+}
+
+// modelUsage holds the usage of a model during a session.
+type modelUsage struct {
+	requests int
+	tokens   chat.Usage
+	cost     float64
+	unpriced bool // Whether the price of the model was unknown.
+}
+
+// usageLog holds the usage of a session, by model.
+type usageLog struct {
+	mu     sync.Mutex
+	models map[string]*modelUsage
+}
+
+// sessionUsage is the usage of the current session.
+var sessionUsage = &usageLog{}
+
+// add records a request to model that used the tokens in u.
+func (l *usageLog) add(model string, u chat.Usage, cost float64, priced bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.models == nil {
+		l.models = map[string]*modelUsage{}
+	}
+	m := l.models[model]
+	if m == nil {
+		m = &modelUsage{}
+		l.models[model] = m
+	}
+	m.requests++
+	m.tokens.PromptTokens += u.PromptTokens
+	m.tokens.CompletionTokens += u.CompletionTokens
+	m.tokens.TotalTokens += u.TotalTokens
+	m.cost += cost
+	m.unpriced = m.unpriced || !priced
+}
+
+// spent returns the cost of the session so far.
+func (l *usageLog) spent() float64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	var total float64
+	for _, m := range l.models {
+		total += m.cost
+	}
+	return total
+}
+
+// reset forgets the usage so far.
+func (l *usageLog) reset() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.models = nil
+}
+
+// checkBudget returns an error if the session spent budget already.
+// A budget of zero is no limit.
+func (l *usageLog) checkBudget(budget float64) error {
+	if spent := l.spent(); budget > 0 && spent >= budget {
+		return fmt.Errorf("session budget of $%g reached ($%.4f spent): raise budget or type \"usage reset\"", budget, spent)
+	}
+	return nil
+}
+
+// String returns a table with the usage of every model, followed by
+// the totals.
+func (l *usageLog) String() string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if len(l.models) == 0 {
+		return "no requests were sent"
+	}
+	ids := make([]string, 0, len(l.models))
+	for id := range l.models {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	var b strings.Builder
+	w := newTableWriter(&b, append(ids, "total"))
+	row := func(name string, m *modelUsage) {
+		cost := fmt.Sprintf("$%.4f", m.cost)
+		if m.unpriced {
+			cost += "?"
+		}
+		fmt.Fprintf(w, "%-*s\t%d\t%d\t%d\t%d\t%s\t\n", w.width, name, m.requests,
+			m.tokens.PromptTokens, m.tokens.CompletionTokens, m.tokens.TotalTokens, cost)
+	}
+	fmt.Fprintf(w, "%-*s\trequests\tprompt\tcompletion\ttotal\tcost\t\n", w.width, "model")
+	var total modelUsage
+	for _, id := range ids {
+		m := l.models[id]
+		row(id, m)
+		total.requests += m.requests
+		total.tokens.PromptTokens += m.tokens.PromptTokens
+		total.tokens.CompletionTokens += m.tokens.CompletionTokens
+		total.tokens.TotalTokens += m.tokens.TotalTokens
+		total.cost += m.cost
+		total.unpriced = total.unpriced || m.unpriced
+	}
+	if len(ids) > 1 {
+		row("total", &total)
+	}
+	w.Flush()
+	text := strings.TrimSuffix(b.String(), "\n")
+	if total.unpriced {
+		text += "\n? The cost of models without a price is not included, type \"pricing\" to set one."
+	}
+	return text
+}
+
+// usageCommand runs the usage command with the given arguments.
+func usageCommand(args []string, ui plugin.UI) error {
+	switch {
+	case len(args) == 0:
+		ui.Print(sessionUsage.String())
+		return nil
+	case len(args) == 1 && args[0] == "reset":
+		sessionUsage.reset()
+		return nil
+	}
+	return errors.New("usage: usage [reset]")
+}
+
+// recordUsage adds the usage u of a request to model to the session
+// usage, and shows it if requested by cfg.
+func recordUsage(ui plugin.UI, cfg config, u chat.Usage) {
+	p, priced, err := priceOf(cfg.Model)
+	if err != nil {
+		ui.PrintErr(err)
+	}
+	cost := p.cost(u)
+	sessionUsage.add(cfg.Model, u, cost, priced)
+	if !cfg.ShowUsage {
+		return
+	}
+	if u.TotalTokens == 0 {
+		ui.Print("tokens: not reported")
+		return
+	}
+	line := fmt.Sprintf("tokens: %d prompt + %d completion = %d", u.PromptTokens, u.CompletionTokens, u.TotalTokens)
+	if priced {
+		line += fmt.Sprintf(", cost: $%.4f (session: $%.4f)", cost, sessionUsage.spent())
+	} else {
+		line += fmt.Sprintf(", cost: unknown for %s", cfg.Model)
+	}
+	ui.Print(line)
+}
@@ -0,0 +1,116 @@
+// MIT License
+//
+// Copyright (c) 2023 Kevin Herro
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// Package paste handles text pasted in a terminal in bracketed paste
+// mode, which keeps pasted text apart from typed text.
+package paste
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"strings"
+)
+
+// Escape sequences of bracketed paste mode. Once it is on, terminals
+// enclose pasted text within Start and End.
+const (
+	modeOn  = "\x1b[?2004h"
+	modeOff = "\x1b[?2004l"
+	Start   = "\x1b[200~"
+	End     = "\x1b[201~"
+)
+
+// Newline stands for the newlines of pasted text while the line
+// holding it is edited, as a newline would end the line.
+const Newline = '↵'
+
+// Enable turns on bracketed paste mode in the terminal showing w and
+// returns a function that turns it off. If w is not a terminal, the
+// escape sequences would end up in its output, so nothing is written.
+func Enable(w *os.File) (disable func()) {
+	if fi, err := w.Stat(); err != nil || fi.Mode()&os.ModeCharDevice == 0 {
+		return func() {}
+	}
+	w.WriteString(modeOn)
+	return func() { w.WriteString(modeOff) }
+}
+
+// Reader reads the input of a terminal in bracketed paste mode,
+// dropping the brackets around pasted text and replacing the newlines
+// in it with Newline.
+type Reader struct {
+	r       *bufio.Reader
+	pasting bool   // Whether the text being read was pasted.
+	pending []byte // Text filtered but not read yet.
+}
+
+// NewReader returns a Reader reading the input of a terminal from r.
+func NewReader(r io.Reader) *Reader {
+	return &Reader{r: bufio.NewReader(r)}
+}
+
+func (p *Reader) Read(b []byte) (int, error) {
+	for len(p.pending) == 0 {
+		c, err := p.r.ReadByte()
+		if err != nil {
+			return 0, err
+		}
+		switch {
+		case c == '\x1b' && p.bracket(Start):
+			p.pasting = true
+		case c == '\x1b' && p.bracket(End):
+			p.pasting = false
+		case p.pasting && (c == '\r' || c == '\n'):
+			if c == '\r' && p.next('\n') {
+				p.r.ReadByte()
+			}
+			p.pending = append(p.pending, string(Newline)...)
+		default:
+			p.pending = append(p.pending, c)
+		}
+	}
+	n := copy(b, p.pending)
+	p.pending = p.pending[n:]
+	return n, nil
+}
+
+// bracket returns true if seq, without its leading escape, was read
+// already and discards it. Only buffered input is looked at, so that
+// the escape key alone does not wait for more input.
+func (p *Reader) bracket(seq string) bool {
+	rest := seq[1:]
+	if p.r.Buffered() < len(rest) {
+		return false
+	}
+	if b, _ := p.r.Peek(len(rest)); string(b) != rest {
+		return false
+	}
+	p.r.Discard(len(rest))
+	return true
+}
+
+// next returns true if c is the next byte of buffered input.
+func (p *Reader) next(c byte) bool {
+	if p.r.Buffered() == 0 {
+		return false
+	}
+	b, _ := p.r.Peek(1)
+	return b[0] == c
+}
+
+// Unpaste restores the newlines of the pasted text in line.
+func Unpaste(line string) string {
+	return strings.ReplaceAll(line, string(Newline), "\n")
+}
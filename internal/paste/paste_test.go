@@ -0,0 +1,54 @@
+// MIT License
+//
+// Copyright (c) 2023 Kevin Herro
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+package paste
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestReader(t *testing.T) {
+	r := NewReader(strings.NewReader("x " + Start + "a\r\nb\n" + End + "y\n\x1b[A"))
+	got, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "x a↵b↵y\n\x1b[A"; string(got) != want {
+		t.Errorf("read %q, want %q", got, want)
+	}
+	if got, want := Unpaste("x a↵b↵y"), "x a\nb\ny"; got != want {
+		t.Errorf("Unpaste() = %q, want %q", got, want)
+	}
+}
+
+func TestEnable(t *testing.T) {
+	// Output redirected to a file must not get the escape sequences.
+	f, err := os.Create(filepath.Join(t.TempDir(), "out"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	Enable(f)()
+	fi, err := f.Stat()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi.Size() != 0 {
+		t.Errorf("wrote %d bytes to a file, want none", fi.Size())
+	}
+}
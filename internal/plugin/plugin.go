@@ -14,12 +14,39 @@
 
 package plugin
 
-import "io"
+import (
+	"io"
+	"net/http"
+)
 
 // Options groups all the optional plugins into vyx.
 type Options struct {
 	Writer Writer
 	UI     UI
+
+	// HTTPClient sends the requests to the API. If nil, a client
+	// that uses Transport is created and reused across requests.
+	HTTPClient *http.Client
+
+	// Transport is used by the client created when HTTPClient is nil.
+	// If nil, http.DefaultTransport is used.
+	Transport http.RoundTripper
+
+	// BaseURL is the URL the paths of API endpoints are relative to,
+	// e.g. that of a proxy or of an OpenAI-compatible server.
+	// If empty, $OPENAI_BASE_URL is used, or the OpenAI API by default.
+	BaseURL string
+
+	// Args are the command-line arguments, without the program name.
+	Args []string
+
+	// Stdin is read for input piped to vyx, unless it is a terminal.
+	// If nil, there is no piped input.
+	Stdin io.Reader
+
+	// Stdout receives the reply to a prompt given on the command line.
+	// If nil, os.Stdout is used.
+	Stdout io.Writer
 }
 
 // Writer provides a mechanism to write data under a certain name,
@@ -28,6 +55,16 @@ type Writer interface {
 	Open(name string) (io.WriteCloser, error)
 }
 
+// An AppendWriter is a Writer that can also add data at the end
+// of what was previously written under a name.
+type AppendWriter interface {
+	Writer
+
+	// Append opens name for writing after its existing data,
+	// creating it if it does not exist.
+	Append(name string) (io.WriteCloser, error)
+}
+
 // A UI manages user interactions.
 type UI interface {
 	// ReadLine returns a line of text (a command) read from the user.
@@ -46,3 +83,46 @@ type UI interface {
 	// For line-based UI, Print writes to STDERR.
 	PrintErr(...any)
 }
+
+// A StreamUI is a UI that can show a message piece by piece, as it is
+// produced. It is used to show replies that are streamed by the API.
+// UIs that do not implement it are given whole lines instead.
+type StreamUI interface {
+	UI
+
+	// PrintPartial shows part of a message to the user.
+	// It formats the text as fmt.Print would and,
+	// unlike Print, does not add a final \n.
+	PrintPartial(...any)
+}
+
+// A CompletingUI is a UI that can complete what the user is typing,
+// typically when the tab key is pressed.
+type CompletingUI interface {
+	UI
+
+	// SetCompleter sets the function returning the candidates that
+	// complete the last word of line, the text typed so far. Every
+	// candidate replaces that word whole.
+	SetCompleter(complete func(line string) []string)
+}
+
+// A HistoryUI is a UI that lets the user recall and search the lines
+// entered previously, possibly in earlier sessions.
+type HistoryUI interface {
+	UI
+
+	// SetHistory replaces the lines that can be recalled with
+	// entries, oldest first. Entries may span several lines.
+	SetHistory(entries []string)
+}
+
+// A TerminalUI is a UI that may show messages on a terminal, where
+// replies can be rendered rather than shown as raw text.
+type TerminalUI interface {
+	UI
+
+	// Width returns the width of the terminal in columns, or 0 if
+	// messages are not shown on a terminal.
+	Width() int
+}
@@ -22,35 +22,82 @@ import (
 
 	"github.com/chzyer/readline"
 	"github.com/kevherro/vyx/driver"
+	"github.com/kevherro/vyx/internal/paste"
 )
 
 func main() {
-	if err := driver.Vyx(&driver.Options{UI: newUI()}); err != nil {
+	if err := driver.Vyx(&driver.Options{
+		UI:     newUI(),
+		Args:   os.Args[1:],
+		Stdin:  os.Stdin,
+		Stdout: os.Stdout,
+	}); err != nil {
 		fmt.Fprintf(os.Stderr, "vyx: %v\n", err)
-		os.Exit(2)
+		os.Exit(driver.ExitStatus(err))
 	}
 }
 
 type readlineUI struct {
 	rl *readline.Instance
+
+	prefix bool // Whether the last key was the Ctrl-X prefix.
+	edit   bool // Whether the line was ended by the edit key binding.
 }
 
 func newUI() driver.UI {
-	rl, err := readline.New("")
+	rl, err := readline.NewEx(&readline.Config{
+		// The driver decides what goes in the history.
+		DisableAutoSaveHistory: true,
+		HistorySearchFold:      true,
+		Stdin:                  readline.NewCancelableStdin(paste.NewReader(os.Stdin)),
+	})
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "readline: %v", err)
 		return nil
 	}
-	return &readlineUI{
+	r := &readlineUI{
 		rl: rl,
 	}
+	rl.Config.FuncFilterInputRune = r.filterKey
+	return r
+}
+
+// filterKey binds Ctrl-X Ctrl-E, as in bash, to the edit command:
+// it ends the line, which ReadLine then hands to the command.
+func (r *readlineUI) filterKey(key rune) (rune, bool) {
+	const ctrlX, ctrlE = 0x18, 0x05
+	prefix := r.prefix
+	r.prefix = key == ctrlX
+	switch {
+	case r.prefix:
+		return key, false
+	case prefix && key == ctrlE:
+		r.edit = true
+		return readline.CharEnter, true
+	}
+	return key, true
 }
 
 // ReadLine returns a line of text (a command) read from the user.
-// prompt is printed before reading the command.
+// prompt is printed before reading the command. Ctrl-C discards the
+// line being edited rather than ending the session. Text pasted in the
+// line is kept whole, even if it spans several lines. Ctrl-X Ctrl-E
+// turns the line into an edit command, to compose it in an editor.
 func (r *readlineUI) ReadLine(prompt string) (string, error) {
+	if readline.IsTerminal(syscall.Stdin) {
+		defer paste.Enable(os.Stdout)()
+	}
 	r.rl.SetPrompt(prompt)
-	return r.rl.Readline()
+	line, err := r.rl.Readline()
+	if err == readline.ErrInterrupt {
+		return "", nil
+	}
+	line = paste.Unpaste(line)
+	if r.edit {
+		r.edit = false
+		line = strings.TrimSpace("edit " + line)
+	}
+	return line, err
 }
 
 // Print shows a message to the user.
@@ -63,6 +110,12 @@ func (r *readlineUI) Print(args ...any) {
 	fmt.Fprint(r.rl.Stderr(), text)
 }
 
+// PrintPartial shows part of a message to the user.
+// It is printed over stderr as stdout is reserved for regular output.
+func (r *readlineUI) PrintPartial(args ...any) {
+	fmt.Fprint(r.rl.Stderr(), args...)
+}
+
 // PrintErr shows a message to the user, colored in red for emphasis.
 // It is printed over stderr as stdout is reserved for regular output.
 func (r *readlineUI) PrintErr(args ...any) {
@@ -76,6 +129,50 @@ func (r *readlineUI) PrintErr(args ...any) {
 	fmt.Fprint(r.rl.Stderr(), text)
 }
 
+// Width returns the width of the terminal, or 0 if messages are not
+// shown on one.
+func (r *readlineUI) Width() int {
+	if !readline.IsTerminal(syscall.Stderr) {
+		return 0
+	}
+	if w := readline.GetScreenWidth(); w > 0 {
+		return w
+	}
+	return 80
+}
+
+// SetHistory replaces the history recalled with the arrow keys and
+// searched with Ctrl-R.
+func (r *readlineUI) SetHistory(entries []string) {
+	// Leave room for the line being edited.
+	r.rl.Config.HistoryLimit = len(entries) + 1
+	r.rl.ResetHistory()
+	for _, e := range entries {
+		r.rl.SaveHistory(e)
+	}
+}
+
+// SetCompleter makes the tab key complete the line being edited
+// with the candidates returned by complete.
+func (r *readlineUI) SetCompleter(complete func(line string) []string) {
+	r.rl.Config.AutoComplete = completer(complete)
+}
+
+// completer adapts a completion function to readline.
+type completer func(line string) []string
+
+// Do returns the suffixes completing the word before pos in line,
+// and the length of that word.
+func (c completer) Do(line []rune, pos int) ([][]rune, int) {
+	text := string(line[:pos])
+	word := []rune(text[strings.LastIndexAny(text, " \t")+1:])
+	var suffixes [][]rune
+	for _, candidate := range c(text) {
+		suffixes = append(suffixes, []rune(candidate)[len(word):])
+	}
+	return suffixes, len(word)
+}
+
 // colorize the msg using ANSI color escapes.
 func colorize(msg string) string {
 	var red = 31